@@ -12,10 +12,39 @@ type APIFilter interface {
 	ProcessFilter(filter model.FilterData, input model.APIRequestData) (model.APIRequestData, error)
 }
 
+//APIResponseObserver is implemented by filters that also want the final status of the requests they see
+type APIResponseObserver interface {
+	ObserveResponse(filter model.FilterData, request model.APIRequestData, status int)
+}
+
+//ConfigValidator is implemented by filters with their own settings to check when the config is loaded
+type ConfigValidator interface {
+	ValidateConfig(filter model.FilterData) error
+}
+
+//ConfigApplier is implemented by filters holding resources for their settings, like open files.
+//ApplyConfig gets the filters using it in the config that just became live.
+type ConfigApplier interface {
+	ApplyConfig(filters []model.FilterData)
+}
+
 var (
-	apiFilters map[string]APIFilter
+	apiFilters      map[string]APIFilter
+	cattleAccessKey string
+	cattleSecretKey string
 )
 
+//SetCattleCredentials stores the proxy service credentials filters may forward to their endpoints
+func SetCattleCredentials(accessKey string, secretKey string) {
+	cattleAccessKey = accessKey
+	cattleSecretKey = secretKey
+}
+
+//CattleCredentials returns the proxy service credentials
+func CattleCredentials() (string, string) {
+	return cattleAccessKey, cattleSecretKey
+}
+
 func GetAPIFilter(name string) APIFilter {
 	if filter, ok := apiFilters[name]; ok {
 		return filter
@@ -23,6 +52,11 @@ func GetAPIFilter(name string) APIFilter {
 	return apiFilters["http"]
 }
 
+//APIFilters returns the registered filters by name
+func APIFilters() map[string]APIFilter {
+	return apiFilters
+}
+
 func RegisterAPIFilter(name string, filter APIFilter) error {
 	if apiFilters == nil {
 		apiFilters = make(map[string]APIFilter)
@@ -0,0 +1,282 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/syslog"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/filters"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+const (
+	name              = "audit"
+	defaultMaxSizeMB  = 100
+	defaultMaxBackups = 5
+	defaultSyslogTag  = "api-filter-proxy"
+	//writeAccess is the W_OK mode of access(2)
+	writeAccess = 2
+)
+
+func init() {
+	auditFilter := &AuditFilter{sinks: make(map[string]*auditSink)}
+	if err := filters.RegisterAPIFilter(name, auditFilter); err != nil {
+		log.Fatalf("Could not register %s filter", name)
+	}
+
+	log.Infof("Configured %s API filter", auditFilter.GetName())
+
+}
+
+//AuditFilter lets every request through and writes a JSON record of it once it is answered
+type AuditFilter struct {
+	mu    sync.Mutex
+	sinks map[string]*auditSink
+	//live holds the sink keys of the applied config, nil until a config is applied
+	live map[string]bool
+}
+
+//auditSink writes records to a file, syslog or both. Guarded by AuditFilter.mu, writers holds the number of
+//records being written and a retired sink is closed once the last of them is done.
+type auditSink struct {
+	io.Writer
+	closers []io.Closer
+	writers int
+	retired bool
+}
+
+func (s *auditSink) Close() {
+	for _, closer := range s.closers {
+		closer.Close()
+	}
+}
+
+func (*AuditFilter) GetName() string {
+	return name
+}
+
+//ProcessFilter allows the request, the record is written in ObserveResponse when the status is known
+func (f *AuditFilter) ProcessFilter(filter model.FilterData, input model.APIRequestData) (model.APIRequestData, error) {
+	return model.APIRequestData{Status: 200}, nil
+}
+
+//ValidateConfig checks the audit settings, and that the file can be written and the syslog socket exists, without
+//opening either so a config that is not applied leaves nothing behind
+func (f *AuditFilter) ValidateConfig(filter model.FilterData) error {
+	if filter.Audit == nil || (filter.Audit.File == "" && filter.Audit.Syslog == "") {
+		return fmt.Errorf("audit filter needs audit.file or audit.syslog")
+	}
+	for _, field := range filter.Audit.RedactFields {
+		if _, err := util.ParseJSONPath(field); err != nil {
+			return err
+		}
+	}
+	if filter.Audit.File != "" {
+		if err := checkWritableFile(filter.Audit.File); err != nil {
+			return err
+		}
+	}
+	if filter.Audit.Syslog != "" && filter.Audit.Syslog != "default" {
+		info, err := os.Stat(filter.Audit.Syslog)
+		if err != nil {
+			return fmt.Errorf("Error reading syslog socket %v: %v", filter.Audit.Syslog, err)
+		}
+		if info.Mode()&os.ModeSocket == 0 {
+			return fmt.Errorf("syslog %v is not a socket", filter.Audit.Syslog)
+		}
+	}
+	return nil
+}
+
+//checkWritableFile checks that path is, or can be created as, a regular file the proxy can write
+func checkWritableFile(path string) error {
+	info, err := os.Stat(path)
+	if err == nil {
+		if !info.Mode().IsRegular() {
+			return fmt.Errorf("audit file %v is not a regular file", path)
+		}
+		if err := syscall.Access(path, writeAccess); err != nil {
+			return fmt.Errorf("audit file %v is not writable: %v", path, err)
+		}
+		return nil
+	}
+	if !os.IsNotExist(err) {
+		return fmt.Errorf("Error reading audit file %v: %v", path, err)
+	}
+	dir := filepath.Dir(path)
+	info, err = os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("Error reading audit file directory %v: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("audit file directory %v is not a directory", dir)
+	}
+	if err := syscall.Access(dir, writeAccess); err != nil {
+		return fmt.Errorf("audit file directory %v is not writable: %v", dir, err)
+	}
+	return nil
+}
+
+//ObserveResponse writes the audit record of a request
+func (f *AuditFilter) ObserveResponse(filter model.FilterData, request model.APIRequestData, status int) {
+	if filter.Audit == nil {
+		return
+	}
+	record := model.AuditRecord{
+		Time:          time.Now().UTC(),
+		UUID:          request.UUID,
+		Identity:      request.Identity,
+		ClientAddress: request.ClientAddress,
+		Method:        request.Method,
+		APIPath:       request.APIPath,
+		EnvID:         request.EnvID,
+		Resource:      request.Resource,
+		Decisions:     util.RedactDecisions(request.Decisions),
+		Status:        status,
+	}
+	if filter.Audit.IncludeBody {
+		record.Body = util.RedactBody(request.Body, filter.Audit.RedactFields)
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		log.Errorf("Error marshalling audit record for request %v: %v", request.UUID, err)
+		return
+	}
+	sink, err := f.acquire(*filter.Audit)
+	if err != nil {
+		log.Errorf("Error opening audit sink, record for request %v lost: %v", request.UUID, err)
+		return
+	}
+	defer f.release(sink)
+	if _, err = sink.Write(append(line, '\n')); err != nil {
+		log.Errorf("Error writing audit record for request %v: %v", request.UUID, err)
+	}
+}
+
+//ApplyConfig opens the sinks of the live audit filters and retires the ones they no longer write to, a retired
+//sink is closed once the records being written to it are done
+func (f *AuditFilter) ApplyConfig(filters []model.FilterData) {
+	live := make(map[string]bool)
+	var configs []model.AuditConfig
+	for _, filter := range filters {
+		if filter.Audit != nil {
+			live[sinkKey(*filter.Audit)] = true
+			configs = append(configs, *filter.Audit)
+		}
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live = live
+	for key, sink := range f.sinks {
+		if !live[key] {
+			delete(f.sinks, key)
+			sink.retired = true
+			if sink.writers == 0 {
+				sink.Close()
+			}
+		}
+	}
+	//opened now so errors show when the config is applied
+	for _, config := range configs {
+		if _, ok := f.sinks[sinkKey(config)]; ok {
+			continue
+		}
+		sink, err := openSink(config)
+		if err != nil {
+			log.Errorf("Error opening audit sink, records will be lost: %v", err)
+			continue
+		}
+		f.sinks[sinkKey(config)] = sink
+	}
+}
+
+//sinkKey identifies the sink of the audit settings
+func sinkKey(config model.AuditConfig) string {
+	return fmt.Sprintf("%v|%v|%v|%v|%v", config.File, config.MaxSizeMB, config.MaxBackups, config.Syslog, config.SyslogTag)
+}
+
+//acquire returns the sink for the audit settings, shared by every filter writing to the same place. It must be
+//released once the record is written. Settings no longer live, of a request started before a reload, get a sink
+//of their own closed on release.
+func (f *AuditFilter) acquire(config model.AuditConfig) (*auditSink, error) {
+	key := sinkKey(config)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sink, ok := f.sinks[key]
+	if !ok {
+		var err error
+		if sink, err = openSink(config); err != nil {
+			return nil, err
+		}
+		if f.live == nil || f.live[key] {
+			f.sinks[key] = sink
+		} else {
+			sink.retired = true
+		}
+	}
+	sink.writers++
+	return sink, nil
+}
+
+//release ends a write to sink, closing it if it was retired meanwhile
+func (f *AuditFilter) release(sink *auditSink) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	sink.writers--
+	if sink.retired && sink.writers == 0 {
+		sink.Close()
+	}
+}
+
+//openSink opens the file and syslog writers of the audit settings
+func openSink(config model.AuditConfig) (*auditSink, error) {
+	sink := &auditSink{}
+	var writers []io.Writer
+	if config.File != "" {
+		maxSizeMB := config.MaxSizeMB
+		if maxSizeMB <= 0 {
+			maxSizeMB = defaultMaxSizeMB
+		}
+		maxBackups := config.MaxBackups
+		if maxBackups <= 0 {
+			maxBackups = defaultMaxBackups
+		}
+		file, err := util.NewRotatingFile(config.File, int64(maxSizeMB)<<20, maxBackups)
+		if err != nil {
+			return nil, err
+		}
+		writers = append(writers, file)
+		sink.closers = append(sink.closers, file)
+	}
+	if config.Syslog != "" {
+		tag := config.SyslogTag
+		if tag == "" {
+			tag = defaultSyslogTag
+		}
+		var writer *syslog.Writer
+		var err error
+		if config.Syslog == "default" {
+			writer, err = syslog.New(syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+		} else {
+			writer, err = syslog.Dial("unixgram", config.Syslog, syslog.LOG_INFO|syslog.LOG_AUTH, tag)
+		}
+		if err != nil {
+			sink.Close()
+			return nil, fmt.Errorf("Error connecting to syslog %v: %v", config.Syslog, err)
+		}
+		writers = append(writers, writer)
+		sink.closers = append(sink.closers, writer)
+	}
+
+	sink.Writer = io.MultiWriter(writers...)
+	return sink, nil
+}
@@ -0,0 +1,97 @@
+package audit
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func auditFilter(config model.AuditConfig) model.FilterData {
+	return model.FilterData{Name: name, Audit: &config}
+}
+
+func TestValidateConfigOpensNothing(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	socket, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: filepath.Join(dir, "log.sock"), Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer socket.Close()
+	file := filepath.Join(dir, "audit.log")
+
+	f := &AuditFilter{sinks: make(map[string]*auditSink)}
+	tests := []struct {
+		config  model.AuditConfig
+		wantErr bool
+	}{
+		{model.AuditConfig{File: file}, false},
+		{model.AuditConfig{Syslog: filepath.Join(dir, "log.sock")}, false},
+		{model.AuditConfig{Syslog: "default"}, false},
+		{model.AuditConfig{File: filepath.Join(dir, "missing", "audit.log")}, true},
+		{model.AuditConfig{File: dir}, true},
+		{model.AuditConfig{Syslog: filepath.Join(dir, "missing.sock")}, true},
+		{model.AuditConfig{File: file, Syslog: dir}, true},
+	}
+	for _, test := range tests {
+		if err := f.ValidateConfig(auditFilter(test.config)); (err != nil) != test.wantErr {
+			t.Errorf("ValidateConfig(%+v) = %v, want error %v", test.config, err, test.wantErr)
+		}
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("validating created %v", file)
+	}
+	if len(f.sinks) != 0 {
+		t.Errorf("validating opened %v sinks", len(f.sinks))
+	}
+}
+
+func TestApplyConfigWaitsForWriters(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	config := model.AuditConfig{File: filepath.Join(dir, "audit.log")}
+
+	f := &AuditFilter{sinks: make(map[string]*auditSink)}
+	f.ApplyConfig([]model.FilterData{auditFilter(config)})
+	sink, err := f.acquire(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the filter is removed while a record is being written
+	f.ApplyConfig(nil)
+	if _, err := sink.Write([]byte("in flight\n")); err != nil {
+		t.Fatalf("write to a sink retired meanwhile failed: %v", err)
+	}
+	f.release(sink)
+	if _, err := sink.Write([]byte("after\n")); err == nil {
+		t.Error("retired sink still open once its writers are done")
+	}
+
+	//a request started before the reload still gets its record written, to a sink closed right after
+	f.ObserveResponse(auditFilter(config), model.APIRequestData{UUID: "late"}, 200)
+	if len(f.sinks) != 0 {
+		t.Errorf("got %v sinks for a config no longer live", len(f.sinks))
+	}
+	content, err := ioutil.ReadFile(config.File)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 2 || lines[0] != "in flight" || !strings.Contains(lines[1], `"late"`) {
+		t.Errorf("got audit file %q", content)
+	}
+}
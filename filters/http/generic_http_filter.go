@@ -6,9 +6,11 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"io/ioutil"
 	"net/http"
+	"strconv"
 
 	"github.com/rancher/api-filter-proxy/filters"
 	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/tracing"
 	"github.com/rancher/api-filter-proxy/util"
 )
 
@@ -40,9 +42,14 @@ func (f *GenericHTTPFilter) ProcessFilter(filter model.FilterData, input model.A
 		return output, err
 	}
 
-	log.Debugf("Request => " + string(bodyContent))
+	logger := util.RequestLogger(input.UUID)
+	logger.Debugf("Request => %s", util.RedactJSON(bodyContent))
 
-	client := &http.Client{}
+	transport, err := util.GetTransport(filter.TLS)
+	if err != nil {
+		return output, err
+	}
+	client := &http.Client{Transport: transport}
 	req, err := http.NewRequest("POST", filter.Endpoint, bytes.NewBuffer(bodyContent))
 	if err != nil {
 		return output, err
@@ -51,15 +58,31 @@ func (f *GenericHTTPFilter) ProcessFilter(filter model.FilterData, input model.A
 	if filter.SecretToken != "" {
 		signature := util.SignString(bodyContent, []byte(filter.SecretToken))
 		req.Header.Set(model.SignatureHeader, signature)
+		logger.Debugf("Signed the request to filter %v", filter.Endpoint)
+	}
+	if filter.ForwardCattleCredentials {
+		accessKey, secretKey := filters.CattleCredentials()
+		if accessKey != "" {
+			req.SetBasicAuth(accessKey, secretKey)
+		}
+	}
+	if input.TraceParent != "" {
+		req.Header.Set(tracing.TraceParentHeader, input.TraceParent)
+	}
+	if input.TraceState != "" {
+		req.Header.Set(tracing.TraceStateHeader, input.TraceState)
+	}
+	if input.UUID != "" {
+		req.Header.Set(model.RequestIDHeader, input.UUID)
 	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Content-Length", string(len(bodyContent)))
+	req.Header.Set("Content-Length", strconv.Itoa(len(bodyContent)))
 
 	resp, err := client.Do(req)
 	if err != nil {
 		return output, err
 	}
-	log.Debugf("Response Status <= " + resp.Status)
+	logger.Debugf("Response Status <= %v", resp.Status)
 	defer resp.Body.Close()
 
 	byteContent, err := ioutil.ReadAll(resp.Body)
@@ -67,7 +90,7 @@ func (f *GenericHTTPFilter) ProcessFilter(filter model.FilterData, input model.A
 		return output, err
 	}
 
-	log.Debugf("Response <= " + string(byteContent))
+	logger.Debugf("Response <= %s", util.RedactJSON(byteContent))
 	json.Unmarshal(byteContent, &output)
 	output.Status = resp.StatusCode
 
@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/notifier"
 	"github.com/rancher/api-filter-proxy/service"
+	"github.com/rancher/api-filter-proxy/tracing"
+	"github.com/rancher/api-filter-proxy/util"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
@@ -13,6 +20,9 @@ import (
 
 var VERSION = "v0.0.0-dev"
 
+//shutdownTimeout bounds the time left to requests in flight and to the span export on shutdown
+const shutdownTimeout = 10 * time.Second
+
 func beforeApp(c *cli.Context) error {
 	if c.GlobalBool("verbose") {
 		log.SetLevel(log.DebugLevel)
@@ -36,6 +46,22 @@ func main() {
 				"Specify path to the config.json file containg API Filter configuration",
 			),
 		},
+		cli.DurationFlag{
+			Name:  "config-watch-interval",
+			Value: 2 * time.Second,
+			Usage: fmt.Sprintf(
+				"How often the config file is checked for changes to reload it, 0 to only reload on SIGHUP or the reload endpoint",
+			),
+			EnvVar: "CONFIG_WATCH_INTERVAL",
+		},
+		cli.DurationFlag{
+			Name:  "config-watch-debounce",
+			Value: time.Second,
+			Usage: fmt.Sprintf(
+				"How long the config file must stay unchanged after a change before it is reloaded",
+			),
+			EnvVar: "CONFIG_WATCH_DEBOUNCE",
+		},
 		cli.StringFlag{
 			Name: "default-destination",
 			Usage: fmt.Sprintf(
@@ -43,6 +69,27 @@ func main() {
 			),
 			EnvVar: "DEFAULT_DESTINATION",
 		},
+		cli.StringFlag{
+			Name: "admin-api-token",
+			Usage: fmt.Sprintf(
+				"Token to send in the X-API-Admin-Token header to change prefilters and destinations through the admin API, changes are refused if not set",
+			),
+			EnvVar: "ADMIN_API_TOKEN",
+		},
+		cli.BoolFlag{
+			Name: "allow-anonymous-cattle-credentials",
+			Usage: fmt.Sprintf(
+				"Allow destinations with cattleCredentials add, which send the Cattle service keys with requests that have no credentials",
+			),
+			EnvVar: "ALLOW_ANONYMOUS_CATTLE_CREDENTIALS",
+		},
+		cli.BoolFlag{
+			Name: "readiness-check-destination",
+			Usage: fmt.Sprintf(
+				"Report not ready on /v1-api-filter-proxy/readyz when the default destination does not answer",
+			),
+			EnvVar: "READINESS_CHECK_DESTINATION",
+		},
 		cli.StringFlag{
 			Name: "cattle-url",
 			Usage: fmt.Sprintf(
@@ -64,6 +111,111 @@ func main() {
 			),
 			EnvVar: "CATTLE_SECRET_KEY",
 		},
+		cli.DurationFlag{
+			Name:  "identity-cache-ttl",
+			Value: time.Minute,
+			Usage: fmt.Sprintf(
+				"How long a caller identity resolved by Cattle is cached",
+			),
+			EnvVar: "IDENTITY_CACHE_TTL",
+		},
+		cli.IntFlag{
+			Name:  "identity-cache-size",
+			Value: 10000,
+			Usage: fmt.Sprintf(
+				"Maximum number of caller identities cached",
+			),
+		},
+		cli.IntFlag{
+			Name:  "notifier-queue-size",
+			Value: 1000,
+			Usage: fmt.Sprintf(
+				"Maximum number of notifications waiting for delivery, further ones are dropped",
+			),
+		},
+		cli.IntFlag{
+			Name:  "notifier-workers",
+			Value: 4,
+			Usage: fmt.Sprintf(
+				"Number of notifications delivered concurrently",
+			),
+		},
+		cli.IntFlag{
+			Name:  "notifier-max-attempts",
+			Value: 5,
+			Usage: fmt.Sprintf(
+				"Number of times a notification is tried before it is given up",
+			),
+		},
+		cli.DurationFlag{
+			Name:  "notifier-backoff",
+			Value: time.Second,
+			Usage: fmt.Sprintf(
+				"Delay before retrying a failed notification, doubled on every further attempt",
+			),
+		},
+		cli.StringFlag{
+			Name: "notifier-queue-dir",
+			Usage: fmt.Sprintf(
+				"Directory where pending notifications are kept so they survive a restart, in memory only if not set",
+			),
+			EnvVar: "NOTIFIER_QUEUE_DIR",
+		},
+		cli.StringFlag{
+			Name: "tracing-otlp-url",
+			Usage: fmt.Sprintf(
+				"OTLP/HTTP traces endpoint spans are exported to, like http://collector:4318/v1/traces, not exported if not set",
+			),
+			EnvVar: "TRACING_OTLP_URL",
+		},
+		cli.StringFlag{
+			Name:  "tracing-service-name",
+			Value: "api-filter-proxy",
+			Usage: fmt.Sprintf(
+				"Service name of the exported spans",
+			),
+		},
+		cli.StringFlag{
+			Name: "access-log",
+			Usage: fmt.Sprintf(
+				"Write one JSON line per request to this file, or to stdout with -, no access log if not set",
+			),
+			EnvVar: "ACCESS_LOG",
+		},
+		cli.IntFlag{
+			Name:  "access-log-max-size",
+			Value: 100,
+			Usage: fmt.Sprintf(
+				"Size in MB at which the access log file is rotated, 0 to never rotate",
+			),
+		},
+		cli.IntFlag{
+			Name:  "access-log-max-backups",
+			Value: 5,
+			Usage: fmt.Sprintf(
+				"Number of rotated access log files kept",
+			),
+		},
+		cli.StringFlag{
+			Name:  "log-format",
+			Value: "text",
+			Usage: fmt.Sprintf(
+				"Format of the application logs, text or json",
+			),
+			EnvVar: "LOG_FORMAT",
+		},
+		cli.StringSliceFlag{
+			Name: "redact-header",
+			Usage: fmt.Sprintf(
+				"Header whose values are hidden from the logs, can be repeated, on top of Authorization, Cookie, Set-Cookie and X-API-Auth-Signature",
+			),
+		},
+		cli.StringSliceFlag{
+			Name: "redact-json-path",
+			Usage: fmt.Sprintf(
+				"JSONPath of a request body field hidden from the logs, like $.registryCredential.password, can be repeated",
+			),
+		},
 		cli.BoolFlag{
 			Name: "debug",
 			Usage: fmt.Sprintf(
@@ -77,30 +229,152 @@ func main() {
 				"Address to listen to (TCP)",
 			),
 		},
+		cli.StringFlag{
+			Name: "tls-cert",
+			Usage: fmt.Sprintf(
+				"Specify path to the PEM certificate to serve TLS on the listen address, reloaded when changed on disk",
+			),
+			EnvVar: "TLS_CERT",
+		},
+		cli.StringFlag{
+			Name: "tls-key",
+			Usage: fmt.Sprintf(
+				"Specify path to the PEM private key matching --tls-cert",
+			),
+			EnvVar: "TLS_KEY",
+		},
+		cli.StringFlag{
+			Name: "tls-client-ca",
+			Usage: fmt.Sprintf(
+				"Specify path to a PEM CA bundle, clients must present a certificate signed by it (mTLS)",
+			),
+			EnvVar: "TLS_CLIENT_CA",
+		},
+		cli.StringFlag{
+			Name:  "tls-min-version",
+			Value: "1.2",
+			Usage: fmt.Sprintf(
+				"Minimum TLS version accepted by the listener (1.0, 1.1, 1.2, 1.3)",
+			),
+			EnvVar: "TLS_MIN_VERSION",
+		},
+		cli.StringSliceFlag{
+			Name: "tls-cipher-suite",
+			Usage: fmt.Sprintf(
+				"IANA name of a cipher suite accepted by the listener, can be repeated (default: Go defaults)",
+			),
+			EnvVar: "TLS_CIPHER_SUITE",
+		},
 	}
 
 	app.Run(os.Args)
 }
 
-func StartService(c *cli.Context) {
+func StartService(c *cli.Context) error {
 	if c.GlobalBool("debug") {
 		log.SetLevel(log.DebugLevel)
 	}
 
-	textFormatter := &log.TextFormatter{
-		FullTimestamp: true,
+	switch c.GlobalString("log-format") {
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+	case "text":
+		textFormatter := &log.TextFormatter{
+			FullTimestamp: true,
+		}
+		log.SetFormatter(textFormatter)
+	default:
+		log.Fatalf("Unknown --log-format %v, expected text or json", c.GlobalString("log-format"))
+	}
+
+	err := util.SetRedaction(c.GlobalStringSlice("redact-header"), c.GlobalStringSlice("redact-json-path"))
+	if err != nil {
+		log.Fatalf("Failed to configure log redaction: %v", err)
+	}
+
+	err = service.SetAccessLog(c.GlobalString("access-log"), int64(c.GlobalInt("access-log-max-size"))<<20, c.GlobalInt("access-log-max-backups"))
+	if err != nil {
+		log.Fatalf("Failed to open the access log: %v", err)
 	}
-	log.SetFormatter(textFormatter)
 
 	manager.SetEnv(c)
 
-	log.Info("Starting Rancher api-filter-proxy service %v", manager.ConfigFields)
+	tracing.Start(tracing.Options{
+		Endpoint:    c.GlobalString("tracing-otlp-url"),
+		ServiceName: c.GlobalString("tracing-service-name"),
+	})
+
+	log.Infof("Starting Rancher api-filter-proxy service %v", manager.MaskedConfig(manager.LoadLiveConfig().Fields()))
+
+	service.AdminAPIToken = c.GlobalString("admin-api-token")
+	service.Wrapper = service.NewMuxWrapper()
 
-	router := service.NewRouter(manager.ConfigFields)
-	service.Wrapper = &service.MuxWrapper{router}
+	service.ReloadOnSIGHUP()
+	if c.GlobalDuration("config-watch-interval") > 0 {
+		service.WatchConfigFile(c.GlobalString("config"), c.GlobalDuration("config-watch-interval"), c.GlobalDuration("config-watch-debounce"))
+	}
+
+	server := &http.Server{
+		Addr:    c.GlobalString("listen"),
+		Handler: service.Wrapper,
+	}
 
-	log.Info("Listening on ", c.GlobalString("listen"))
+	stopped := shutdownOnSignal(server)
 
-	log.Fatal(http.ListenAndServe(c.GlobalString("listen"), service.Wrapper))
+	if c.GlobalString("tls-cert") == "" && c.GlobalString("tls-key") == "" {
+		log.Info("Listening on ", server.Addr)
+		waitShutdown(server.ListenAndServe(), stopped)
+		return nil
+	}
+
+	if c.GlobalString("tls-cert") == "" || c.GlobalString("tls-key") == "" {
+		log.Fatal("Both --tls-cert and --tls-key must be specified to serve TLS")
+	}
+	tlsConfig, err := service.NewServerTLSConfig(service.TLSOptions{
+		CertFile:     c.GlobalString("tls-cert"),
+		KeyFile:      c.GlobalString("tls-key"),
+		ClientCAFile: c.GlobalString("tls-client-ca"),
+		MinVersion:   c.GlobalString("tls-min-version"),
+		CipherSuites: c.GlobalStringSlice("tls-cipher-suite"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to configure TLS: %v", err)
+	}
+	server.TLSConfig = tlsConfig
 
+	log.Info("Listening with TLS on ", server.Addr)
+	//certificates are served by tlsConfig.GetCertificate
+	waitShutdown(server.ListenAndServeTLS("", ""), stopped)
+	return nil
+}
+
+//shutdownOnSignal stops the server on SIGINT or SIGTERM, letting the requests in flight finish, then writes the
+//accepted notifications to the queue dir and sends the spans not exported yet. The returned channel is closed once done.
+func shutdownOnSignal(server *http.Server) chan struct{} {
+	stopped := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		received := <-signals
+		log.Infof("%v received, shutting down", received)
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := server.Shutdown(ctx); err != nil {
+			log.Warnf("Error waiting for the requests in flight: %v", err)
+		}
+		if err := notifier.Stop(ctx); err != nil {
+			log.Warnf("Error writing the accepted notifications to the queue dir: %v", err)
+		}
+		tracing.Shutdown(shutdownTimeout)
+		close(stopped)
+	}()
+	return stopped
+}
+
+//waitShutdown exits on listener errors, or waits for shutdownOnSignal when the server was shut down
+func waitShutdown(err error, stopped chan struct{}) {
+	if err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
 }
@@ -0,0 +1,63 @@
+package manager
+
+import (
+	"net/http"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//setTestCattleKeys sets the proxy Cattle keys and returns a func restoring the previous ones
+func setTestCattleKeys(allowAnonymous bool) func() {
+	previousAccess, previousSecret, previousAllow := CattleAccessKey, CattleSecretKey, AllowAnonymousCattleCredentials
+	CattleAccessKey, CattleSecretKey, AllowAnonymousCattleCredentials = "service", "secret", allowAnonymous
+	return func() {
+		CattleAccessKey, CattleSecretKey, AllowAnonymousCattleCredentials = previousAccess, previousSecret, previousAllow
+	}
+}
+
+func TestAddCattleCredentialsNeedsOptIn(t *testing.T) {
+	defer setTestCattleKeys(false)()
+	config := ConfigFileFields{Destinations: []Destination{{DestinationURL: "http://cattle:8080", CattleCredentials: CattleCredentialsAdd}}}
+	if err := validateCattleCredentials(config); err == nil {
+		t.Error("cattleCredentials add accepted without --allow-anonymous-cattle-credentials")
+	}
+	config.Destinations[0].CattleCredentials = CattleCredentialsReplace
+	if err := validateCattleCredentials(config); err != nil {
+		t.Errorf("cattleCredentials replace refused: %v", err)
+	}
+
+	AllowAnonymousCattleCredentials = true
+	config.Destinations[0].CattleCredentials = CattleCredentialsAdd
+	if err := validateCattleCredentials(config); err != nil {
+		t.Errorf("cattleCredentials add refused with the opt-in: %v", err)
+	}
+}
+
+func TestApplyAddCattleCredentials(t *testing.T) {
+	logger := log.WithField("test", "cattle credentials")
+	destination := Destination{DestinationURL: "http://cattle:8080", CattleCredentials: CattleCredentialsAdd}
+	basicAuth := func(headers map[string][]string) string {
+		req := http.Request{Header: headers}
+		if accessKey, _, ok := req.BasicAuth(); ok {
+			return accessKey
+		}
+		return ""
+	}
+
+	defer setTestCattleKeys(false)()
+	if got := basicAuth(applyCattleCredentials(logger, destination, nil, map[string][]string{})); got != "" {
+		t.Errorf("anonymous request sent with the %v keys without the opt-in", got)
+	}
+
+	AllowAnonymousCattleCredentials = true
+	if got := basicAuth(applyCattleCredentials(logger, destination, nil, map[string][]string{})); got != "service" {
+		t.Errorf("anonymous request sent with keys %q, want the service keys", got)
+	}
+	//the caller's own credentials are kept
+	caller := http.Request{Header: http.Header{}}
+	caller.SetBasicAuth("caller", "password")
+	if got := basicAuth(applyCattleCredentials(logger, destination, nil, caller.Header)); got != "caller" {
+		t.Errorf("request sent with keys %q, want the caller's", got)
+	}
+}
@@ -0,0 +1,192 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//ConfigUpdateError is a failed config change with the HTTP status to answer
+type ConfigUpdateError struct {
+	Status  int
+	Message string
+}
+
+func (e *ConfigUpdateError) Error() string {
+	return e.Message
+}
+
+//NotFoundError is returned by an update that can not find what it changes
+func NotFoundError(format string, args ...interface{}) error {
+	return &ConfigUpdateError{Status: http.StatusNotFound, Message: fmt.Sprintf(format, args...)}
+}
+
+//errConfigSymlink refuses to replace a symlinked config file, like a mounted ConfigMap, with a plain file
+var errConfigSymlink = fmt.Errorf("the config file is a symlink, change its target instead")
+
+//contentID derives an ID from the JSON of v, stable as long as its settings do not change
+func contentID(v interface{}) string {
+	content, _ := json.Marshal(v)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:6])
+}
+
+//assignConfigIDs gives an ID to the prefilters and destinations that have none
+func assignConfigIDs(configFields *ConfigFileFields) {
+	used := make(map[string]bool)
+	for _, filter := range configFields.Prefilters {
+		used[filter.ID] = true
+	}
+	for _, destination := range configFields.Destinations {
+		used[destination.ID] = true
+	}
+	uniqueID := func(id string) string {
+		//identical entries get the same content ID
+		candidate := id
+		for i := 2; used[candidate]; i++ {
+			candidate = fmt.Sprintf("%v-%v", id, i)
+		}
+		used[candidate] = true
+		return candidate
+	}
+	for i, filter := range configFields.Prefilters {
+		if filter.ID == "" {
+			configFields.Prefilters[i].ID = uniqueID(contentID(filter))
+		}
+	}
+	for i, destination := range configFields.Destinations {
+		if destination.ID == "" {
+			configFields.Destinations[i].ID = uniqueID(contentID(destination))
+		}
+	}
+}
+
+func validateConfigIDs(configFields ConfigFileFields) error {
+	ids := make(map[string]bool)
+	for _, filter := range configFields.Prefilters {
+		if ids[filter.ID] {
+			return fmt.Errorf("ID %v is used more than once", filter.ID)
+		}
+		ids[filter.ID] = true
+	}
+	for _, destination := range configFields.Destinations {
+		if ids[destination.ID] {
+			return fmt.Errorf("ID %v is used more than once", destination.ID)
+		}
+		ids[destination.ID] = true
+	}
+	return nil
+}
+
+//UpdateConfig applies update to a copy of the live config, validates it, writes it to the config
+//file and makes it live, which it returns. Errors are *ConfigUpdateError, the live config is unchanged on error.
+func UpdateConfig(update func(configFields *ConfigFileFields) error) (ConfigFileFields, error) {
+	//wait for any reload or other update to finish
+	*refreshReqChannel <- 1
+	defer func() { <-*refreshReqChannel }()
+
+	configFields := LoadLiveConfig().fields
+	var updatedConfigFields ConfigFileFields
+	//deep copy so the update can not touch the live config
+	content, err := json.Marshal(configFields)
+	if err == nil {
+		err = json.Unmarshal(content, &updatedConfigFields)
+	}
+	if err != nil {
+		return configFields, &ConfigUpdateError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Error copying the config: %v", err)}
+	}
+
+	if err := update(&updatedConfigFields); err != nil {
+		if _, ok := err.(*ConfigUpdateError); ok {
+			return configFields, err
+		}
+		return configFields, &ConfigUpdateError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
+	assignConfigIDs(&updatedConfigFields)
+	if err := validateConfig(updatedConfigFields); err != nil {
+		return configFields, &ConfigUpdateError{Status: http.StatusBadRequest, Message: fmt.Sprintf("Invalid config: %v", err)}
+	}
+	content, err = writeConfigFile(updatedConfigFields)
+	if err == errConfigSymlink {
+		return configFields, &ConfigUpdateError{Status: http.StatusConflict, Message: fmt.Sprintf("Error writing the config file: %v", err)}
+	}
+	if err != nil {
+		log.Errorf("Error writing the config file %v: %v", configFile, err)
+		return configFields, &ConfigUpdateError{Status: http.StatusInternalServerError, Message: fmt.Sprintf("Error writing the config file: %v", err)}
+	}
+	applyConfig(updatedConfigFields)
+	setLoadedConfig(content)
+	log.Infof("Config updated through the admin API")
+	return updatedConfigFields, nil
+}
+
+//writeConfigFile replaces the config file atomically, readers see the old or the new file, never a partial
+//one. It returns the content written, or errConfigSymlink when the config file is a symlink.
+func writeConfigFile(configFields ConfigFileFields) ([]byte, error) {
+	if info, err := os.Lstat(configFile); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return nil, errConfigSymlink
+	}
+	content, err := json.MarshalIndent(configFields, "", "\t")
+	if err != nil {
+		return nil, err
+	}
+	content = append(content, '\n')
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(configFile); err == nil {
+		mode = info.Mode().Perm()
+	}
+	tmpFile, err := ioutil.TempFile(filepath.Dir(configFile), "."+filepath.Base(configFile)+".tmp")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return nil, err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return nil, err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(tmpFile.Name(), mode); err != nil {
+		return nil, err
+	}
+	return content, os.Rename(tmpFile.Name(), configFile)
+}
+
+//ConfigFileChanged reports if the config file content differs from the one last loaded or written
+func ConfigFileChanged() bool {
+	content, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		//let Reload report it
+		return true
+	}
+	loadedConfigHashMu.Lock()
+	defer loadedConfigHashMu.Unlock()
+	return sha256.Sum256(content) != loadedConfigHash
+}
+
+func setLoadedConfig(content []byte) {
+	loadedConfigHashMu.Lock()
+	defer loadedConfigHashMu.Unlock()
+	loadedConfigHash = sha256.Sum256(content)
+}
+
+//KeepSecretToken returns the current token when token is the masked value shown by the admin API
+func KeepSecretToken(token string, current string) string {
+	if token == util.RedactedValue {
+		return current
+	}
+	return token
+}
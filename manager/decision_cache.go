@@ -0,0 +1,130 @@
+package manager
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+const defaultDecisionCacheSize = 10000
+
+var (
+	decisionCacheRequests = metrics.NewCounterVec(
+		"api_filter_proxy_filter_cache_requests_total",
+		"Lookups in the decision cache of a filter, by result hit or miss",
+		"filter", "result",
+	)
+
+	decisionCacheKeys = map[string]bool{"caller": true, "method": true, "path": true, "envID": true}
+)
+
+func validateDecisionCache(cache *model.DecisionCacheConfig) error {
+	if cache == nil {
+		return nil
+	}
+	if ttl, err := time.ParseDuration(cache.TTL); err != nil || ttl <= 0 {
+		return fmt.Errorf("cache ttl %v is not a positive duration", cache.TTL)
+	}
+	for _, key := range cache.KeyBy {
+		if !decisionCacheKeys[key] {
+			return fmt.Errorf("cache keyBy %v is not one of caller, method, path or envID", key)
+		}
+	}
+	return nil
+}
+
+//buildDecisionCaches creates empty caches for the prefilters that have one
+func buildDecisionCaches(prefilters []model.FilterData) map[int]*util.TTLCache {
+	caches := make(map[int]*util.TTLCache)
+	for i, filter := range prefilters {
+		if filter.Cache == nil {
+			continue
+		}
+		//validated when the config is loaded
+		ttl, _ := time.ParseDuration(filter.Cache.TTL)
+		maxEntries := filter.Cache.MaxEntries
+		if maxEntries <= 0 {
+			maxEntries = defaultDecisionCacheSize
+		}
+		caches[i] = util.NewTTLCache(ttl, maxEntries)
+	}
+	return caches
+}
+
+//callFilter calls the filter, or answers from its decision cache if it has one
+func callFilter(ctx context.Context, cache *util.TTLCache, filterData model.FilterData, requestData model.APIRequestData, headers map[string][]string) (model.APIRequestData, error) {
+	if cache == nil {
+		return processFilter(ctx, filterData, requestData)
+	}
+
+	key := decisionCacheKey(filterData.Cache, requestData, headers)
+	if cached, ok := cache.Get(key); ok {
+		decisionCacheRequests.Inc(filterLabel(filterData), "hit")
+		return cached.(model.APIRequestData), nil
+	}
+	decisionCacheRequests.Inc(filterLabel(filterData), "miss")
+
+	responseData, err := processFilter(ctx, filterData, requestData)
+	if err == nil && isCacheable(responseData) {
+		cache.Set(key, responseData)
+	}
+	return responseData, err
+}
+
+//isCacheable reports if a filter response is a plain allow or a deny. Responses changing the
+//request depend on more than the cache key and are never cached.
+func isCacheable(responseData model.APIRequestData) bool {
+	if responseData.Status != 200 {
+		return true
+	}
+	return responseData.Body == nil && responseData.Headers == nil && len(responseData.BodyPatch) == 0 &&
+		responseData.BodyMergePatch == nil && len(responseData.HeaderPatch) == 0 && responseData.Destination == ""
+}
+
+//decisionCacheKey builds the cache key of a request from the keyBy attributes. The query and, but for GET and HEAD,
+//the body the filter is sent are always part of it, a decision for one action or body must not allow another.
+func decisionCacheKey(cacheConfig *model.DecisionCacheConfig, requestData model.APIRequestData, headers map[string][]string) string {
+	keyBy := cacheConfig.KeyBy
+	if len(keyBy) == 0 {
+		keyBy = []string{"caller", "method", "path", "envID"}
+	}
+	var parts []string
+	for _, key := range keyBy {
+		switch key {
+		case "caller":
+			caller := ""
+			if requestData.Identity != nil && requestData.Identity.AccountID != "" {
+				caller = requestData.Identity.AccountID
+			} else if credential, _ := callerCredential(headers); credential != "" {
+				//never keep raw credentials in memory longer than the request
+				sum := sha256.Sum256([]byte(credential))
+				caller = hex.EncodeToString(sum[:])
+			}
+			parts = append(parts, "caller="+caller)
+		case "method":
+			parts = append(parts, "method="+requestData.Method)
+		case "path":
+			parts = append(parts, "path="+requestData.APIPath)
+		case "envID":
+			parts = append(parts, "envID="+requestData.EnvID)
+		}
+	}
+	//Encode sorts the parameters so their order does not matter
+	parts = append(parts, "query="+url.Values(requestData.Query).Encode())
+	if method := strings.ToUpper(requestData.Method); method != "GET" && method != "HEAD" {
+		//maps are marshalled with sorted keys
+		body, _ := json.Marshal(requestData.Body)
+		sum := sha256.Sum256(body)
+		parts = append(parts, "body="+hex.EncodeToString(sum[:]))
+	}
+	return strings.Join(parts, "\x00")
+}
@@ -0,0 +1,62 @@
+package manager
+
+import (
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//ExplainedFilter describes a prefilter a request goes through
+type ExplainedFilter struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint,omitempty"`
+	//Shadow filters are called but never change or stop the request
+	Shadow  bool                 `json:"shadow,omitempty"`
+	Rollout *model.RolloutConfig `json:"rollout,omitempty"`
+	Cached  bool                 `json:"cached,omitempty"`
+}
+
+//Explanation describes what the proxy does with a request
+type Explanation struct {
+	Method        string            `json:"method"`
+	RouteTemplate string            `json:"routeTemplate,omitempty"`
+	Resource      model.Resource    `json:"resource"`
+	Filters       []ExplainedFilter `json:"filters"`
+	Notifiers     []string          `json:"notifiers"`
+	Destination   string            `json:"destination"`
+	//CattleCredentials is how the destination gets the proxy Cattle keys, if at all
+	CattleCredentials string `json:"cattleCredentials,omitempty"`
+}
+
+//Explain returns the filters, notifiers and destination of a request going through ProcessPreFilters with this
+//config, matched by routeTemplate or by resource only when empty. Filters with a rollout may still skip the request.
+func (config *LiveConfig) Explain(routeTemplate string, method string, resource model.Resource) Explanation {
+	configFields := config.fields
+	explanation := Explanation{
+		Method:        method,
+		RouteTemplate: routeTemplate,
+		Resource:      resource,
+		Filters:       []ExplainedFilter{},
+		Notifiers:     []string{},
+	}
+	for _, index := range matchPreFilters(configFields.Prefilters, routeTemplate, method, resource) {
+		filter := configFields.Prefilters[index]
+		explanation.Filters = append(explanation.Filters, ExplainedFilter{
+			Name:     filter.Name,
+			Endpoint: filter.Endpoint,
+			Shadow:   !isEnforced(filter),
+			Rollout:  filter.Rollout,
+			Cached:   filter.Cache != nil,
+		})
+	}
+	request := model.APIRequestData{RouteTemplate: routeTemplate, Method: method, Resource: resource}
+	for _, notifier := range matchNotifiers(configFields.Notifiers, request) {
+		explanation.Notifiers = append(explanation.Notifiers, notifier.Endpoint)
+	}
+
+	destination, ok := config.pathDestinations[routeTemplate]
+	if !ok {
+		destination = Destination{DestinationURL: DefaultDestination}
+	}
+	explanation.Destination = destination.DestinationURL
+	explanation.CattleCredentials = destination.CattleCredentials
+	return explanation
+}
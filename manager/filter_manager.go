@@ -1,43 +1,93 @@
 package manager
 
 import (
+	"crypto/sha256"
 	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
 	"github.com/rancher/api-filter-proxy/filters"
 	//to register all filters
+	_ "github.com/rancher/api-filter-proxy/filters/audit"
 	_ "github.com/rancher/api-filter-proxy/filters/http"
 	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/notifier"
 	"github.com/rancher/api-filter-proxy/util"
 	"github.com/urfave/cli"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 )
 
 var (
 	configFile         string
 	CattleURL          string
+	CattleAccessKey    string
+	CattleSecretKey    string
 	DefaultDestination string
-	ConfigFields       ConfigFileFields
-	//PathPreFilters is the map storing path -> prefilters[]
-	PathPreFilters map[string][]model.FilterData
-	//PathDestinations is the map storing path -> prefilters[]
-	PathDestinations  map[string]Destination
-	refreshReqChannel *chan int
+	//AllowAnonymousCattleCredentials lets "add" destinations send the proxy Cattle keys with requests carrying no credentials
+	AllowAnonymousCattleCredentials bool
+	refreshReqChannel               *chan int
+	//OnConfigApplied, when set, is called with every config made live, before the next reload or update can start
+	OnConfigApplied func(configFields ConfigFileFields)
+	//loadedConfigHash is the hash of the config file content last loaded or written
+	loadedConfigHash   [sha256.Size]byte
+	loadedConfigHashMu sync.Mutex
+	//currentConfig holds the *LiveConfig requests are processed with
+	currentConfig atomic.Value
+)
+
+//LiveConfig is what a request is processed with. applyConfig publishes it as a whole so a request
+//never mixes the filters of one config with the decision caches or destinations of another.
+type LiveConfig struct {
+	fields           ConfigFileFields
+	pathDestinations map[string]Destination
+	//decisionCaches maps the index of a prefilter in fields to its cache
+	decisionCaches map[int]*util.TTLCache
+}
+
+//LoadLiveConfig returns the config new requests are processed with, a request should load it once
+func LoadLiveConfig() *LiveConfig {
+	if config, ok := currentConfig.Load().(*LiveConfig); ok {
+		return config
+	}
+	return &LiveConfig{}
+}
+
+//Fields returns the settings of the config, they must not be changed
+func (config *LiveConfig) Fields() ConfigFileFields {
+	return config.fields
+}
+
+const (
+	//CattleCredentialsReplace always sends the proxy Cattle keys to the destination
+	CattleCredentialsReplace = "replace"
+	//CattleCredentialsAdd sends the proxy Cattle keys only when the request has no credentials, which hands
+	//the service account to anonymous callers so it needs AllowAnonymousCattleCredentials
+	CattleCredentialsAdd = "add"
 )
 
 //Destination defines the properties of a Destination
 type Destination struct {
-	DestinationURL string   `json:"destinationURL"`
-	Paths          []string `json:"paths"`
+	//ID names the destination in the admin API, derived from its settings when not set
+	ID             string           `json:"id,omitempty"`
+	DestinationURL string           `json:"destinationURL"`
+	Paths          []string         `json:"paths"`
+	TLS            *model.TLSConfig `json:"tls,omitempty"`
+	//CattleCredentials is one of "", "replace" or "add"
+	CattleCredentials string `json:"cattleCredentials,omitempty"`
 }
 
 //ConfigFileFields stores filter config
 type ConfigFileFields struct {
-	Prefilters   []model.FilterData
-	Destinations []Destination
+	Prefilters   []model.FilterData   `json:"prefilters"`
+	Destinations []Destination        `json:"destinations"`
+	Notifiers    []model.NotifierData `json:"notifiers,omitempty"`
 }
 
 //SetEnv sets the parameters necessary
@@ -54,6 +104,15 @@ func SetEnv(c *cli.Context) {
 		log.Fatalf("CATTLE_URL is not set")
 	}
 
+	CattleAccessKey = c.GlobalString("cattle-access-key")
+	CattleSecretKey = c.GlobalString("cattle-secret-key")
+	filters.SetCattleCredentials(CattleAccessKey, CattleSecretKey)
+	AllowAnonymousCattleCredentials = c.GlobalBool("allow-anonymous-cattle-credentials")
+
+	initIdentityCache(c.GlobalDuration("identity-cache-ttl"), c.GlobalInt("identity-cache-size"))
+
+	ReadinessCheckDestination = c.GlobalBool("readiness-check-destination")
+
 	DefaultDestination = c.GlobalString("default-destination")
 	if len(DefaultDestination) == 0 {
 		log.Infof("DEFAULT_DESTINATION is not set, will use CATTLE_URL as default")
@@ -64,16 +123,28 @@ func SetEnv(c *cli.Context) {
 	refreshReqChannel = &refChan
 
 	if configFile != "" {
-		ConfigFields = ConfigFileFields{}
-		PathPreFilters = make(map[string][]model.FilterData)
-		PathDestinations = make(map[string]Destination)
 		err := Reload()
 		if err != nil {
 			log.Fatalf("Failed to load the proxy Config: %v", err)
 		}
 	}
+
+	//started once the notifiers are known, the notifications left on disk are delivered right away
+	err := notifier.Start(notifier.Options{
+		QueueSize:   c.GlobalInt("notifier-queue-size"),
+		Workers:     c.GlobalInt("notifier-workers"),
+		MaxAttempts: c.GlobalInt("notifier-max-attempts"),
+		Backoff:     c.GlobalDuration("notifier-backoff"),
+		QueueDir:    c.GlobalString("notifier-queue-dir"),
+	})
+	if err != nil {
+		log.Fatalf("Failed to start the notifier queue: %v", err)
+	}
 }
 
+//ErrReloadInProgress is returned by Reload when another reload or config update is running, the config file was not read
+var ErrReloadInProgress = fmt.Errorf("Reload config is already in process")
+
 func Reload() error {
 	//put msg on channel, so that any other request can wait
 	select {
@@ -83,6 +154,8 @@ func Reload() error {
 			if err != nil {
 				log.Errorf("Error reading config.json file at path %v", configFile)
 				<-*refreshReqChannel
+				configReloads.Inc("failure")
+				configLastReloadSuccess.Set(0)
 				return fmt.Errorf("Error reading config.json file at path %v", configFile)
 			}
 			updatedConfigFields := ConfigFileFields{}
@@ -90,96 +163,451 @@ func Reload() error {
 			if err != nil {
 				log.Errorf("config.json data format invalid, error : %v\n", err)
 				<-*refreshReqChannel
+				configReloads.Inc("failure")
+				configLastReloadSuccess.Set(0)
 				return fmt.Errorf("Proxy config.json data format invalid, error : %v", err)
 			}
 
-			updatedPathPreFilters := make(map[string][]model.FilterData)
-			for _, filter := range updatedConfigFields.Prefilters {
-				//build the PathPreFilters map
-				for _, path := range filter.Paths {
-					updatedPathPreFilters[path] = append(updatedPathPreFilters[path], filter)
-				}
-			}
-
-			updatedPathDestinations := make(map[string]Destination)
-			for _, destination := range updatedConfigFields.Destinations {
-				//build the PathDestinations map
-				for _, path := range destination.Paths {
-					updatedPathDestinations[path] = destination
-				}
+			assignConfigIDs(&updatedConfigFields)
+			err = validateConfig(updatedConfigFields)
+			if err != nil {
+				log.Errorf("config.json settings invalid, error : %v\n", err)
+				<-*refreshReqChannel
+				configReloads.Inc("failure")
+				configLastReloadSuccess.Set(0)
+				return fmt.Errorf("Proxy config.json settings invalid, error : %v", err)
 			}
-			ConfigFields = updatedConfigFields
-			PathPreFilters = updatedPathPreFilters
-			PathDestinations = updatedPathDestinations
 
+			applyConfig(updatedConfigFields)
+			setLoadedConfig(configContent)
+			configReloads.Inc("success")
+			configLastReloadSuccess.Set(1)
 		}
 		<-*refreshReqChannel
 	default:
 		log.Infof("Reload config is already in process, skipping")
+		return ErrReloadInProgress
+	}
+	return nil
+}
+
+//applyConfig makes a validated config the live one
+func applyConfig(updatedConfigFields ConfigFileFields) {
+	updatedPathDestinations := make(map[string]Destination)
+	for _, destination := range updatedConfigFields.Destinations {
+		//build the path -> destination map
+		for _, path := range destination.Paths {
+			updatedPathDestinations[path] = destination
+		}
+	}
+	currentConfig.Store(&LiveConfig{
+		fields:           updatedConfigFields,
+		pathDestinations: updatedPathDestinations,
+		//cached decisions may not hold with the new filters
+		decisionCaches: buildDecisionCaches(updatedConfigFields.Prefilters),
+	})
+	notifier.SetNotifiers(updatedConfigFields.Notifiers)
+	applyFilterConfigs(updatedConfigFields.Prefilters)
+	//rotated CA and certificate files are picked up on reload
+	util.ResetTransports()
+	//readiness probes the new endpoints and TLS settings right away
+	probeResults.Purge()
+	setConfigLoaded()
+	if OnConfigApplied != nil {
+		OnConfigApplied(updatedConfigFields)
+	}
+}
+
+//applyFilterConfigs tells the filters holding resources which of their settings are live
+func applyFilterConfigs(prefilters []model.FilterData) {
+	for name, apiFilter := range filters.APIFilters() {
+		applier, ok := apiFilter.(filters.ConfigApplier)
+		if !ok {
+			continue
+		}
+		var live []model.FilterData
+		for _, filter := range prefilters {
+			if filter.Name == name {
+				live = append(live, filter)
+			}
+		}
+		applier.ApplyConfig(live)
+	}
+}
+
+//validateConfig checks the settings json.Unmarshal cannot
+func validateConfig(configFields ConfigFileFields) error {
+	if err := validateConfigIDs(configFields); err != nil {
+		return err
+	}
+	if err := validateTLSConfigs(configFields); err != nil {
+		return err
+	}
+	if err := validateCattleCredentials(configFields); err != nil {
+		return err
+	}
+	for _, filter := range configFields.Prefilters {
+		if filter.Endpoint == "" && !builtInFilter(filter.Name) {
+			return fmt.Errorf("filter %v has no endpoint", filter.Name)
+		}
+		if len(filter.Paths) > 0 && len(filter.Methods) == 0 {
+			return fmt.Errorf("filter %v has paths but no methods", filterLabel(filter))
+		}
+		for _, selector := range filter.Resources {
+			if selector.Type == "" {
+				return fmt.Errorf("filter %v has a resources selector without type", filter.Endpoint)
+			}
+		}
+		if err := validateInclude(filter.Include); err != nil {
+			return fmt.Errorf("filter %v: %v", filter.Endpoint, err)
+		}
+		if err := validateRollout(filter.Rollout); err != nil {
+			return fmt.Errorf("filter %v: %v", filter.Endpoint, err)
+		}
+		if err := validateDecisionCache(filter.Cache); err != nil {
+			return fmt.Errorf("filter %v: %v", filter.Endpoint, err)
+		}
+		if validator, ok := filters.GetAPIFilter(filter.Name).(filters.ConfigValidator); ok {
+			if err := validator.ValidateConfig(filter); err != nil {
+				return fmt.Errorf("filter %v: %v", filter.Name, err)
+			}
+		}
+	}
+	for _, notifier := range configFields.Notifiers {
+		if notifier.Endpoint == "" {
+			return fmt.Errorf("notifier without endpoint")
+		}
+		if len(notifier.Paths) > 0 && len(notifier.Methods) == 0 {
+			return fmt.Errorf("notifier %v has paths but no methods", notifier.Endpoint)
+		}
+		for _, selector := range notifier.Resources {
+			if selector.Type == "" {
+				return fmt.Errorf("notifier %v has a resources selector without type", notifier.Endpoint)
+			}
+		}
+		if notifier.TLS != nil {
+			if _, err := util.NewClientTLSConfig(*notifier.TLS); err != nil {
+				return fmt.Errorf("notifier %v: %v", notifier.Endpoint, err)
+			}
+		}
+	}
+	for _, destination := range configFields.Destinations {
+		if err := validateDestinationURL(destination.DestinationURL); err != nil {
+			return fmt.Errorf("destination %v: %v", destination.ID, err)
+		}
+	}
+	return nil
+}
+
+//builtInFilter reports if name is a filter running in the proxy, the http filter needs an endpoint
+func builtInFilter(name string) bool {
+	_, registered := filters.APIFilters()[name]
+	return registered && name != "http"
+}
+
+//validateDestinationURL checks that requests can be proxied to destinationURL
+func validateDestinationURL(destinationURL string) error {
+	if destinationURL == "" {
+		return fmt.Errorf("destinationURL is empty")
+	}
+	parsed, err := url.Parse(destinationURL)
+	if err != nil {
+		return fmt.Errorf("invalid destinationURL %v: %v", destinationURL, err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("destinationURL %v is not an http or https URL", destinationURL)
+	}
+	return nil
+}
+
+//validateTLSConfigs checks that the CA and key pair files of every filter and destination can be loaded
+func validateTLSConfigs(configFields ConfigFileFields) error {
+	for _, filter := range configFields.Prefilters {
+		if filter.TLS != nil {
+			if _, err := util.NewClientTLSConfig(*filter.TLS); err != nil {
+				return fmt.Errorf("filter %v: %v", filter.Endpoint, err)
+			}
+		}
+	}
+	for _, destination := range configFields.Destinations {
+		if destination.TLS != nil {
+			if _, err := util.NewClientTLSConfig(*destination.TLS); err != nil {
+				return fmt.Errorf("destination %v: %v", destination.DestinationURL, err)
+			}
+		}
+	}
+	return nil
+}
+
+//validateCattleCredentials checks the cattleCredentials mode of every destination
+func validateCattleCredentials(configFields ConfigFileFields) error {
+	for _, destination := range configFields.Destinations {
+		switch destination.CattleCredentials {
+		case "":
+		case CattleCredentialsReplace, CattleCredentialsAdd:
+			if CattleAccessKey == "" || CattleSecretKey == "" {
+				return fmt.Errorf("destination %v uses cattleCredentials but CATTLE_ACCESS_KEY or CATTLE_SECRET_KEY is not set", destination.DestinationURL)
+			}
+			if destination.CattleCredentials == CattleCredentialsAdd && !AllowAnonymousCattleCredentials {
+				return fmt.Errorf("destination %v uses cattleCredentials add, which sends the proxy Cattle keys with requests that have no credentials, start the proxy with --allow-anonymous-cattle-credentials to allow it", destination.DestinationURL)
+			}
+		default:
+			return fmt.Errorf("destination %v has unknown cattleCredentials mode %v", destination.DestinationURL, destination.CattleCredentials)
+		}
+	}
+	for _, filter := range configFields.Prefilters {
+		if filter.ForwardCattleCredentials && (CattleAccessKey == "" || CattleSecretKey == "") {
+			return fmt.Errorf("filter %v uses forwardCattleCredentials but CATTLE_ACCESS_KEY or CATTLE_SECRET_KEY is not set", filter.Endpoint)
+		}
 	}
 	return nil
 }
 
-func ProcessPreFilters(path string, api string, body map[string]interface{}, headers map[string][]string) (map[string]interface{}, map[string][]string, string, model.ProxyError) {
-	prefilters := PathPreFilters[path]
-	log.Debugf("START -- Processing pre filters for request path %v", path)
-	inputBody := body
+//applyCattleCredentials sets the Cattle service keys on the headers sent to the destination
+func applyCattleCredentials(logger *log.Entry, destination Destination, identity *model.Identity, headers map[string][]string) map[string][]string {
+	header := http.Header{}
+	for key, value := range headers {
+		//filters may return non canonical header names
+		header[http.CanonicalHeaderKey(key)] = append(header[http.CanonicalHeaderKey(key)], value...)
+	}
+	//never trust a caller header the proxy is responsible for
+	header.Del(model.OriginalCallerHeader)
+
+	if destination.CattleCredentials == "" {
+		return header
+	}
+	if destination.CattleCredentials == CattleCredentialsAdd {
+		if credential, _ := callerCredential(header); credential != "" {
+			return header
+		}
+		if !AllowAnonymousCattleCredentials {
+			return header
+		}
+		logger.Debugf("Sending the proxy Cattle keys to %v for a request without credentials", destination.DestinationURL)
+	}
+
+	if caller := originalCaller(logger, identity, header); caller != "" {
+		header.Set(model.OriginalCallerHeader, caller)
+	}
+	//the destination must only see the service credentials
+	removeCookie(header, tokenCookieName)
+	req := http.Request{Header: header}
+	req.SetBasicAuth(CattleAccessKey, CattleSecretKey)
+	return header
+}
+
+//matchPreFilters returns, in config order, the indexes of the prefilters selecting the request by path template or by resource
+func matchPreFilters(prefilters []model.FilterData, path string, method string, resource model.Resource) []int {
+	var matched []int
+	for i, filter := range prefilters {
+		if MatchesRequest(filter.RequestSelector, path, method, resource) {
+			matched = append(matched, i)
+		}
+	}
+	return matched
+}
+
+//ProcessPreFilters runs the prefilters selecting the request and returns the request to send, its destination
+//and the notifiers to call once it is answered. The body is only parsed as JSON when a prefilter selects the
+//request, the returned request has no Body otherwise and the original body should be sent as is.
+func ProcessPreFilters(path string, r *http.Request, bodyBytes []byte, headers map[string][]string) (model.APIRequestData, Destination, []model.NotifierData, model.ProxyError) {
+	request := NewRequestData(path, r)
+	config := LoadLiveConfig()
+	configFields := config.fields
+	prefilters := matchPreFilters(configFields.Prefilters, path, r.Method, request.Resource)
+	notifiers := matchNotifiers(configFields.Notifiers, request)
+	logger := util.RequestLogger(request.UUID)
+	logger.Debugf("START -- Processing pre filters for request path %v", path)
+	var inputBody map[string]interface{}
 	inputHeaders := headers
-	//add uuid
-	UUID := util.GenerateUUID()
-	//envId
-	envID := extractEnvID(api)
+	destinationOverride := ""
+	//the request as it stands when a filter stops it, for the response observers
+	failed := func(svcErr model.ProxyError) (model.APIRequestData, Destination, []model.NotifierData, model.ProxyError) {
+		request.Body = inputBody
+		request.Headers = inputHeaders
+		svcErr.RequestID = request.UUID
+		return request, Destination{}, nil, svcErr
+	}
+
+	if len(prefilters) > 0 && len(bodyBytes) > 0 {
+		err := json.Unmarshal(bodyBytes, &inputBody)
+		if err != nil {
+			logger.Errorf("Error unmarshalling json request body: %v", err)
+			svcErr := model.ProxyError{
+				Status:  strconv.Itoa(http.StatusBadRequest),
+				Message: fmt.Sprintf("Error reading json request body: %v", err),
+			}
+			return failed(svcErr)
+		}
+	}
 
-	for _, filterData := range prefilters {
-		log.Debugf("-- Processing pre filter %v for request path %v --", filterData, path)
+	//caller identity, only worth a Cattle round trip if some filter or notifier will see it
+	if len(prefilters) > 0 || len(notifiers) > 0 {
+		identity, err := resolveIdentity(logger, headers)
+		if err != nil {
+			logger.Errorf("Error resolving the caller identity for request path %v: %v", path, err)
+		}
+		request.Identity = identity
+	}
 
-		requestData := model.APIRequestData{}
-		requestData.Body = inputBody
-		requestData.Headers = inputHeaders
-		requestData.UUID = UUID
-		requestData.APIPath = api
-		if envID != "" {
-			requestData.EnvID = envID
+	for _, index := range prefilters {
+		filterData := configFields.Prefilters[index]
+		if !inRollout(filterData, request, headers) {
+			logger.Debugf("-- Skipping pre filter %v for request path %v, request is out of its rollout --", filterLabel(filterData), path)
+			continue
 		}
+		logger.Debugf("-- Processing pre filter %v for request path %v --", filterLabel(filterData), path)
 
-		apiFilter := filters.GetAPIFilter(filterData.Name)
-		responseData, err := apiFilter.ProcessFilter(filterData, requestData)
+		requestData := request
+		requestData.Body = includeBody(filterData.Include, inputBody)
+		requestData.Headers = includeHeaders(filterData.Include, inputHeaders)
+		requestData.Decisions = includeDecisions(filterData.Include, request.Decisions)
+
+		responseData, err := callFilter(r.Context(), config.decisionCaches[index], filterData, requestData, inputHeaders)
+		decision := newDecision(filterData, responseData, err)
+		if !isEnforced(filterData) {
+			//shadow mode, record what the filter would have done and carry on with the request untouched
+			request.Decisions = append(request.Decisions, shadowDecision(filterData, decision, request, responseData, inputBody, inputHeaders))
+			continue
+		}
+		request.Decisions = append(request.Decisions, decision)
 		if err != nil {
-			log.Errorf("Error %v processing the filter %v", err, filterData)
+			logger.Errorf("Error %v processing the filter %v", err, filterLabel(filterData))
 			svcErr := model.ProxyError{
 				Status:  strconv.Itoa(http.StatusInternalServerError),
-				Message: fmt.Sprintf("Error %v processing the filter %v", err, filterData),
+				Message: fmt.Sprintf("Error %v processing the filter %v", err, filterLabel(filterData)),
 			}
-			return inputBody, inputHeaders, "", svcErr
+			return failed(svcErr)
 		}
 		if responseData.Status == 200 {
-			if responseData.Body != nil {
-				inputBody = responseData.Body
+			if responseData.Destination != "" {
+				destinationOverride = responseData.Destination
 			}
-			if responseData.Headers != nil {
-				inputHeaders = responseData.Headers
+			inputBody, inputHeaders, err = applyFilterResponse(logger, filterData, responseData, inputBody, inputHeaders)
+			if err != nil {
+				logger.Errorf("Error %v applying the patches returned by filter %v", err, filterLabel(filterData))
+				svcErr := model.ProxyError{
+					Status:  strconv.Itoa(http.StatusInternalServerError),
+					Message: fmt.Sprintf("Error %v applying the patches returned by filter %v", err, filterData.Endpoint),
+				}
+				return failed(svcErr)
 			}
 		} else {
 			//error
-			log.Errorf("Error response %v - %v while processing the filter %v", responseData.Status, responseData.Body, filterData)
+			logger.Errorf("Error response %v - %v while processing the filter %v", responseData.Status, util.RedactValue(responseData.Body), filterLabel(filterData))
 			svcErr := model.ProxyError{
 				Status:  strconv.Itoa(responseData.Status),
 				Message: fmt.Sprintf("Error response while processing the filter %v", filterData.Endpoint),
 			}
 
-			return inputBody, inputHeaders, "", svcErr
+			return failed(svcErr)
 		}
 	}
 
 	//send the final body and headers to destination
-	destination, ok := PathDestinations[path]
-	destinationURL := destination.DestinationURL
+	destination, ok := config.pathDestinations[path]
 	if !ok {
-		destinationURL = DefaultDestination
+		destination = Destination{DestinationURL: DefaultDestination}
+	}
+	if destinationOverride != "" {
+		//only destinations from config are allowed, so filters can not turn the proxy into an open proxy
+		overrideDestination, ok := findDestination(configFields.Destinations, destinationOverride)
+		if !ok {
+			logger.Errorf("Filter chose destination %v for request path %v which is not in the proxy config", destinationOverride, path)
+			svcErr := model.ProxyError{
+				Status:  strconv.Itoa(http.StatusInternalServerError),
+				Message: fmt.Sprintf("Filter chose destination %v which is not in the proxy config", destinationOverride),
+			}
+			return failed(svcErr)
+		}
+		logger.Debugf("Filter overrides destination %v with %v for request path %v", destination.DestinationURL, overrideDestination.DestinationURL, path)
+		destination = overrideDestination
 	}
-	log.Debugf("DONE -- Processing pre filters for request path %v, following to destination %v", path, destinationURL)
+	request.Body = inputBody
+	request.Headers = applyCattleCredentials(logger, destination, request.Identity, inputHeaders)
+	logger.Debugf("DONE -- Processing pre filters for request path %v, following to destination %v", path, destination.DestinationURL)
+
+	return request, destination, notifiers, model.ProxyError{}
+}
+
+//newDecision records the outcome of a filter call
+func newDecision(filter model.FilterData, responseData model.APIRequestData, err error) model.FilterDecision {
+	decision := model.FilterDecision{Name: filter.Name, Endpoint: filter.Endpoint, Status: responseData.Status}
+	switch {
+	case err != nil:
+		decision.Decision = model.DecisionError
+	case responseData.Status == 200:
+		decision.Decision = model.DecisionAllow
+	default:
+		decision.Decision = model.DecisionDeny
+	}
+	return decision
+}
 
-	return inputBody, inputHeaders, destinationURL, model.ProxyError{}
+//ObserveResponse hands the final status of a request to the filters that watch responses, like audit
+func ObserveResponse(request model.APIRequestData, status int) {
+	configFields := LoadLiveConfig().fields
+	for _, index := range matchPreFilters(configFields.Prefilters, request.RouteTemplate, request.Method, request.Resource) {
+		filterData := configFields.Prefilters[index]
+		if observer, ok := filters.GetAPIFilter(filterData.Name).(filters.APIResponseObserver); ok {
+			observer.ObserveResponse(filterData, request, status)
+		}
+	}
+}
+
+//NewRequestData fills the request metadata sent to filters and notifiers, without headers and body
+func NewRequestData(path string, r *http.Request) model.APIRequestData {
+	requestData := model.APIRequestData{}
+	//the request ID is the UUID, service.MuxWrapper makes sure every request has one
+	requestData.UUID = r.Header.Get(model.RequestIDHeader)
+	if requestData.UUID == "" {
+		requestData.UUID = util.GenerateUUID()
+	}
+	//hashBy request must not be steered by the client, it gets a key of its own
+	requestData.RolloutKey = util.GenerateUUID()
+	requestData.APIPath = r.URL.Path
+	//envId
+	requestData.EnvID = extractEnvID(r.URL.Path)
+	if requestData.EnvID == "" {
+		requestData.EnvID = r.Header.Get(model.ProjectIDHeader)
+	}
+	requestData.Method = r.Method
+	requestData.Query = r.URL.Query()
+	clientAddress, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientAddress = r.RemoteAddr
+	}
+	requestData.ClientAddress = clientAddress
+	requestData.RouteTemplate = path
+	requestData.Vars = mux.Vars(r)
+	requestData.Resource = ParseResource(r.URL.Path, requestData.Query)
+	return requestData
+}
+
+//findDestination returns the configured destination with the given URL, the default destination included
+func findDestination(destinations []Destination, destinationURL string) (Destination, bool) {
+	destinationURL = strings.TrimSuffix(destinationURL, "/")
+	for _, destination := range destinations {
+		if strings.TrimSuffix(destination.DestinationURL, "/") == destinationURL {
+			return destination, true
+		}
+	}
+	if strings.TrimSuffix(DefaultDestination, "/") == destinationURL {
+		return Destination{DestinationURL: DefaultDestination}, true
+	}
+	return Destination{}, false
+}
+
+//DestinationLabel names destination in metrics: its config ID, "default" for the default destination and
+//"other" for anything else, so per-request URLs do not grow the number of series
+func DestinationLabel(destination Destination) string {
+	if destination.ID != "" {
+		return destination.ID
+	}
+	if strings.TrimSuffix(destination.DestinationURL, "/") == strings.TrimSuffix(DefaultDestination, "/") {
+		return "default"
+	}
+	return "other"
 }
 
 func extractEnvID(requestURL string) string {
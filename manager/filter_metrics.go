@@ -0,0 +1,51 @@
+package manager
+
+import (
+	"context"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/filters"
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/tracing"
+)
+
+var (
+	filterDuration = metrics.NewHistogramVec(
+		"api_filter_proxy_filter_duration_seconds",
+		"Time spent calling a filter, by outcome allow, deny or error",
+		metrics.DefaultBuckets,
+		"filter", "outcome",
+	)
+
+	configReloads = metrics.NewCounterVec(
+		"api_filter_proxy_config_reloads_total",
+		"Config reloads, by result success or failure",
+		"result",
+	)
+
+	configLastReloadSuccess = metrics.NewGaugeVec(
+		"api_filter_proxy_config_last_reload_success",
+		"1 if the last config reload succeeded, 0 if the proxy still runs an older config",
+	)
+)
+
+//processFilter calls the filter in a child span of the request and records how long it took and what it decided
+func processFilter(ctx context.Context, filterData model.FilterData, requestData model.APIRequestData) (model.APIRequestData, error) {
+	span := tracing.StartChildSpan(ctx, "filter "+filterLabel(filterData), tracing.KindClient)
+	defer span.Finish()
+	requestData.TraceParent = span.Context.TraceParent()
+	requestData.TraceState = span.Context.TraceState
+
+	start := time.Now()
+	responseData, err := filters.GetAPIFilter(filterData.Name).ProcessFilter(filterData, requestData)
+	decision := newDecision(filterData, responseData, err)
+	filterDuration.Observe(time.Since(start).Seconds(), filterLabel(filterData), decision.Decision)
+
+	span.SetAttribute("filter.name", filterData.Name)
+	span.SetAttribute("filter.decision", decision.Decision)
+	if err != nil {
+		span.SetError(err.Error())
+	}
+	return responseData, err
+}
@@ -0,0 +1,186 @@
+package manager
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+const (
+	//identityAPIVersion is the Cattle API version used to resolve callers
+	identityAPIVersion = "/v2-beta"
+	tokenCookieName    = "token"
+	userIDHeader       = "X-Api-User-Id"
+	accountIDHeader    = "X-Api-Account-Id"
+)
+
+var (
+	identityCache  *util.TTLCache
+	identityClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+type cattleCollection struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+type cattleAccount struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"`
+}
+
+//initIdentityCache sets up the cache of resolved callers
+func initIdentityCache(ttl time.Duration, maxEntries int) {
+	identityCache = util.NewTTLCache(ttl, maxEntries)
+}
+
+//callerCredential returns the raw credential of the caller and how to send it to Cattle
+func callerCredential(headers map[string][]string) (string, http.Header) {
+	header := http.Header(headers)
+	if auth := header.Get("Authorization"); auth != "" {
+		return auth, http.Header{"Authorization": []string{auth}}
+	}
+	req := http.Request{Header: header}
+	if cookie, err := req.Cookie(tokenCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value, http.Header{"Cookie": []string{(&http.Cookie{Name: tokenCookieName, Value: cookie.Value}).String()}}
+	}
+	return "", nil
+}
+
+//originalCaller names the caller whose credentials are replaced, the access key with Basic auth,
+//otherwise the Cattle account of the bearer token or token cookie
+func originalCaller(logger *log.Entry, identity *model.Identity, headers map[string][]string) string {
+	req := http.Request{Header: headers}
+	if accessKey, _, ok := req.BasicAuth(); ok {
+		return accessKey
+	}
+	if identity == nil {
+		var err error
+		identity, err = resolveIdentity(logger, headers)
+		if err != nil {
+			logger.Errorf("Error resolving the original caller: %v", err)
+		}
+	}
+	if identity != nil {
+		return identity.AccountID
+	}
+	return ""
+}
+
+//removeCookie drops the cookie name from the Cookie headers, keeping the others
+func removeCookie(header http.Header, name string) {
+	req := http.Request{Header: header}
+	var kept []string
+	for _, cookie := range req.Cookies() {
+		if cookie.Name != name {
+			kept = append(kept, cookie.String())
+		}
+	}
+	header.Del("Cookie")
+	if len(kept) > 0 {
+		header.Set("Cookie", strings.Join(kept, "; "))
+	}
+}
+
+//resolveIdentity asks Cattle who the caller is, results are cached per credential
+func resolveIdentity(logger *log.Entry, headers map[string][]string) (*model.Identity, error) {
+	credential, authHeader := callerCredential(headers)
+	if credential == "" {
+		return nil, nil
+	}
+	sum := sha256.Sum256([]byte(credential))
+	cacheKey := hex.EncodeToString(sum[:])
+	if identityCache != nil {
+		if cached, ok := identityCache.Get(cacheKey); ok {
+			return cached.(*model.Identity), nil
+		}
+	}
+
+	identity, err := fetchIdentity(logger, authHeader)
+	if err != nil {
+		return nil, err
+	}
+	if identityCache != nil {
+		//unknown callers are cached too so bad credentials do not hit Cattle on every request
+		identityCache.Set(cacheKey, identity)
+	}
+	return identity, nil
+}
+
+func fetchIdentity(logger *log.Entry, authHeader http.Header) (*model.Identity, error) {
+	projects := cattleCollection{}
+	resp, err := cattleGet(identityAPIVersion+"/projects?limit=-1", authHeader, &projects)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		logger.Debugf("Caller credentials rejected by Cattle with status %v", resp.StatusCode)
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Cattle returned status %v listing the caller projects", resp.StatusCode)
+	}
+
+	identity := &model.Identity{AccountID: resp.Header.Get(userIDHeader)}
+	if identity.AccountID == "" {
+		identity.AccountID = resp.Header.Get(accountIDHeader)
+	}
+	for _, project := range projects.Data {
+		identity.Projects = append(identity.Projects, project.ID)
+	}
+	if identity.AccountID == "" {
+		return identity, nil
+	}
+
+	account := cattleAccount{}
+	resp, err = cattleGet(identityAPIVersion+"/accounts/"+identity.AccountID, authHeader, &account)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		identity.Kind = account.Kind
+	} else {
+		logger.Debugf("Cattle returned status %v reading account %v", resp.StatusCode, identity.AccountID)
+	}
+	return identity, nil
+}
+
+//cattleGet calls Cattle with the caller credentials and decodes a 200 response into into
+func cattleGet(path string, authHeader http.Header, into interface{}) (*http.Response, error) {
+	req, err := http.NewRequest("GET", strings.TrimSuffix(CattleURL, "/")+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, value := range authHeader {
+		req.Header[key] = value
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := identityClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Error calling Cattle at %v: %v", req.URL.Path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return resp, nil
+	}
+	byteContent, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(byteContent, into); err != nil {
+		return nil, fmt.Errorf("Error reading Cattle response for %v: %v", req.URL.Path, err)
+	}
+	return resp, nil
+}
@@ -0,0 +1,92 @@
+package manager
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//validateInclude checks the JSONPath expressions of a filter include settings
+func validateInclude(include *model.FilterInclude) error {
+	if include == nil {
+		return nil
+	}
+	if len(include.Headers) > 0 && len(include.ExcludeHeaders) > 0 {
+		return fmt.Errorf("include can not set both headers and excludeHeaders")
+	}
+	for _, field := range include.BodyFields {
+		if _, err := util.ParseJSONPath(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//includesFullBody reports if the filter is sent the whole request body
+func includesFullBody(include *model.FilterInclude) bool {
+	return include == nil || ((include.Body == nil || *include.Body) && len(include.BodyFields) == 0)
+}
+
+//includesAllHeaders reports if the filter is sent every request header
+func includesAllHeaders(include *model.FilterInclude) bool {
+	return include == nil || (len(include.Headers) == 0 && len(include.ExcludeHeaders) == 0)
+}
+
+//includeBody returns the part of the body the filter is allowed to see
+func includeBody(include *model.FilterInclude, body map[string]interface{}) map[string]interface{} {
+	if includesFullBody(include) || body == nil {
+		return body
+	}
+	if include.Body != nil && !*include.Body {
+		return nil
+	}
+	var selected interface{}
+	for _, field := range include.BodyFields {
+		//expressions are checked when the config is loaded
+		path, _ := util.ParseJSONPath(field)
+		if fieldSelected, ok := path.Select(body); ok {
+			selected = util.MergeSelections(selected, fieldSelected)
+		}
+	}
+	selectedBody, _ := selected.(map[string]interface{})
+	return selectedBody
+}
+
+//includeHeaders returns the headers the filter is allowed to see
+func includeHeaders(include *model.FilterInclude, headers map[string][]string) map[string][]string {
+	if includesAllHeaders(include) {
+		return headers
+	}
+	allowed := toHeaderSet(include.Headers)
+	excluded := toHeaderSet(include.ExcludeHeaders)
+	included := make(map[string][]string)
+	for key, value := range headers {
+		name := http.CanonicalHeaderKey(key)
+		if len(allowed) > 0 && !allowed[name] {
+			continue
+		}
+		if excluded[name] {
+			continue
+		}
+		included[key] = value
+	}
+	return included
+}
+
+func toHeaderSet(names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[http.CanonicalHeaderKey(name)] = true
+	}
+	return set
+}
+
+//includeDecisions returns the earlier decisions the filter is allowed to see, with the changes they list redacted
+func includeDecisions(include *model.FilterInclude, decisions []model.FilterDecision) []model.FilterDecision {
+	if include == nil || !include.Decisions {
+		return nil
+	}
+	return util.RedactDecisions(decisions)
+}
@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+func TestIncludeDecisions(t *testing.T) {
+	if err := util.SetRedaction([]string{"Authorization"}, []string{"$.password"}); err != nil {
+		t.Fatal(err)
+	}
+	defer util.SetRedaction(nil, nil)
+
+	decisions := []model.FilterDecision{{
+		Name:       "shadow",
+		Decision:   model.DecisionAllow,
+		Shadow:     true,
+		BodyDiff:   []model.JSONPatchOperation{{Op: "add", Path: "/password", Value: json.RawMessage(`"hunter2"`)}},
+		HeaderDiff: []model.HeaderOperation{{Op: "set", Name: "Authorization", Value: "Bearer token"}},
+	}}
+
+	//not sent by default, whatever else the filter sees
+	for _, include := range []*model.FilterInclude{nil, {}, {ExcludeHeaders: []string{"Cookie"}}} {
+		if got := includeDecisions(include, decisions); got != nil {
+			t.Errorf("include %+v sent decisions %+v", include, got)
+		}
+	}
+
+	got := includeDecisions(&model.FilterInclude{Decisions: true}, decisions)
+	if len(got) != 1 || got[0].Name != "shadow" || !got[0].Shadow {
+		t.Fatalf("got decisions %+v", got)
+	}
+	if string(got[0].BodyDiff[0].Value) != `"[REDACTED]"` || got[0].HeaderDiff[0].Value != util.RedactedValue {
+		t.Errorf("got changes %+v %+v, want them redacted", got[0].BodyDiff, got[0].HeaderDiff)
+	}
+	if decisions[0].HeaderDiff[0].Value != "Bearer token" {
+		t.Error("the decisions of the request were changed")
+	}
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func TestConfigAppliedInsideReloadLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	content := `{"prefilters": [], "destinations": [{"destinationURL": "http://backend:8080", "paths": ["/v1/stacks"]}]}`
+	if err := ioutil.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	previousFile, previousConfig, previousChannel := configFile, LoadLiveConfig(), refreshReqChannel
+	defer func() {
+		configFile, refreshReqChannel, OnConfigApplied = previousFile, previousChannel, nil
+		currentConfig.Store(previousConfig)
+	}()
+	configFile = path
+	refChan := make(chan int, 1)
+	refreshReqChannel = &refChan
+
+	applied := 0
+	OnConfigApplied = func(configFields ConfigFileFields) {
+		applied++
+		//a reload started meanwhile must wait, the router built here is the one of the live config
+		if err := Reload(); err != ErrReloadInProgress {
+			t.Errorf("got %v reloading from OnConfigApplied, want ErrReloadInProgress", err)
+		}
+		live := LoadLiveConfig()
+		if len(configFields.Destinations) != 1 || len(live.Fields().Destinations) != 1 || live.Fields().Destinations[0].ID != configFields.Destinations[0].ID {
+			t.Errorf("got config %+v, live %+v", configFields, live.Fields())
+		}
+	}
+	if err := Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if applied != 1 {
+		t.Fatalf("OnConfigApplied called %v times, want 1", applied)
+	}
+
+	explanation := LoadLiveConfig().Explain("/v1/stacks", "GET", model.Resource{})
+	if explanation.Destination != "http://backend:8080" {
+		t.Errorf("got destination %v", explanation.Destination)
+	}
+}
@@ -0,0 +1,23 @@
+package manager
+
+import (
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//MaskedConfig returns a copy of configFields with the filter and notifier secret tokens masked, safe to log or show
+func MaskedConfig(configFields ConfigFileFields) ConfigFileFields {
+	masked := ConfigFileFields{Destinations: configFields.Destinations}
+	for _, filter := range configFields.Prefilters {
+		if filter.SecretToken != "" {
+			filter.SecretToken = util.RedactedValue
+		}
+		masked.Prefilters = append(masked.Prefilters, filter)
+	}
+	for _, notifier := range configFields.Notifiers {
+		if notifier.SecretToken != "" {
+			notifier.SecretToken = util.RedactedValue
+		}
+		masked.Notifiers = append(masked.Notifiers, notifier)
+	}
+	return masked
+}
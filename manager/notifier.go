@@ -0,0 +1,15 @@
+package manager
+
+import (
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func matchNotifiers(notifiers []model.NotifierData, request model.APIRequestData) []model.NotifierData {
+	var matched []model.NotifierData
+	for _, notifier := range notifiers {
+		if MatchesRequest(notifier.RequestSelector, request.RouteTemplate, request.Method, request.Resource) {
+			matched = append(matched, notifier)
+		}
+	}
+	return matched
+}
@@ -0,0 +1,68 @@
+package manager
+
+import (
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//applyFilterResponse returns the body and headers as changed by a filter response: replaced
+//by the returned body and headers, then patched
+func applyFilterResponse(logger *log.Entry, filterData model.FilterData, responseData model.APIRequestData, body map[string]interface{}, headers map[string][]string) (map[string]interface{}, map[string][]string, error) {
+	//a filter that only saw part of the request can not replace all of it
+	if responseData.Body != nil {
+		if includesFullBody(filterData.Include) {
+			body = responseData.Body
+		} else {
+			logger.Warnf("Ignoring the body returned by filter %v, it was not sent the full body", filterData.Endpoint)
+		}
+	}
+	if responseData.Headers != nil {
+		if includesAllHeaders(filterData.Include) {
+			headers = responseData.Headers
+		} else {
+			logger.Warnf("Ignoring the headers returned by filter %v, it was not sent all headers", filterData.Endpoint)
+		}
+	}
+	//patches always apply to the full request, whatever part the filter was sent
+	return applyPatches(responseData, body, headers)
+}
+
+//applyPatches applies the body and header patches returned by a filter, in the order JSON Patch, merge patch, header operations
+func applyPatches(responseData model.APIRequestData, body map[string]interface{}, headers map[string][]string) (map[string]interface{}, map[string][]string, error) {
+	if len(responseData.BodyPatch) > 0 || responseData.BodyMergePatch != nil {
+		var doc interface{} = body
+		if body == nil {
+			doc = map[string]interface{}{}
+		}
+		var err error
+		if len(responseData.BodyPatch) > 0 {
+			doc, err = util.ApplyJSONPatch(doc, responseData.BodyPatch)
+			if err != nil {
+				return body, headers, err
+			}
+		}
+		if responseData.BodyMergePatch != nil {
+			doc, err = util.ApplyMergePatch(doc, responseData.BodyMergePatch)
+			if err != nil {
+				return body, headers, err
+			}
+		}
+		patchedBody, ok := doc.(map[string]interface{})
+		if !ok {
+			return body, headers, fmt.Errorf("patched body is not a JSON object")
+		}
+		body = patchedBody
+	}
+
+	if len(responseData.HeaderPatch) > 0 {
+		patchedHeaders, err := util.ApplyHeaderOperations(headers, responseData.HeaderPatch)
+		if err != nil {
+			return body, headers, err
+		}
+		headers = patchedHeaders
+	}
+	return body, headers, nil
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+const (
+	readinessCheckTimeout = 2 * time.Second
+	//readinessCacheTTL is how long a probe result is reused, so frequent readiness checks do not load the filters
+	readinessCacheTTL = 5 * time.Second
+)
+
+var (
+	//configLoaded is 1 once a config was loaded successfully
+	configLoaded int32
+	//ReadinessCheckDestination makes readiness depend on the default destination answering
+	ReadinessCheckDestination bool
+
+	//probeResults holds the recent probe errors by endpoint, "" when the probe succeeded
+	probeResults = util.NewTTLCache(readinessCacheTTL, 1000)
+)
+
+func setConfigLoaded() {
+	atomic.StoreInt32(&configLoaded, 1)
+}
+
+//ReadinessCheck is the result of one readiness check
+type ReadinessCheck struct {
+	Name  string `json:"name"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+//CheckReadiness reports if the proxy can serve requests: the config is loaded and, when asked for,
+//the default destination and the endpoints of required filters answer
+func CheckReadiness() (bool, []ReadinessCheck) {
+	if atomic.LoadInt32(&configLoaded) == 0 {
+		return false, []ReadinessCheck{{Name: "config", Error: "config not loaded"}}
+	}
+	checks := []ReadinessCheck{{Name: "config", OK: true}}
+
+	type target struct {
+		name     string
+		endpoint string
+		tls      *model.TLSConfig
+	}
+	var targets []target
+	if ReadinessCheckDestination {
+		targets = append(targets, target{name: "destination " + DefaultDestination, endpoint: DefaultDestination})
+	}
+	for _, filter := range LoadLiveConfig().fields.Prefilters {
+		if filter.Required && filter.Endpoint != "" {
+			targets = append(targets, target{name: "filter " + filter.Endpoint, endpoint: filter.Endpoint, tls: filter.TLS})
+		}
+	}
+
+	results := make([]ReadinessCheck, len(targets))
+	var wg sync.WaitGroup
+	for i, t := range targets {
+		wg.Add(1)
+		go func(i int, t target) {
+			defer wg.Done()
+			results[i] = ReadinessCheck{Name: t.name, OK: true}
+			if probeError := probeEndpoint(t.endpoint, t.tls); probeError != "" {
+				results[i] = ReadinessCheck{Name: t.name, Error: probeError}
+			}
+		}(i, t)
+	}
+	wg.Wait()
+
+	ready := true
+	for _, result := range results {
+		ready = ready && result.OK
+	}
+	return ready, append(checks, results...)
+}
+
+//probeEndpoint returns the error of checkEndpoint, reusing the results younger than readinessCacheTTL
+func probeEndpoint(endpoint string, tlsConfig *model.TLSConfig) string {
+	if cached, ok := probeResults.Get(endpoint); ok {
+		return cached.(string)
+	}
+	probeError := ""
+	if err := checkEndpoint(endpoint, tlsConfig); err != nil {
+		probeError = err.Error()
+	}
+	probeResults.Set(endpoint, probeError)
+	return probeError
+}
+
+//checkEndpoint succeeds when the endpoint answers, whatever the status, short of a server error
+func checkEndpoint(endpoint string, tlsConfig *model.TLSConfig) error {
+	transport, err := util.GetTransport(tlsConfig)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport, Timeout: readinessCheckTimeout}
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("answered %v", resp.Status)
+	}
+	return nil
+}
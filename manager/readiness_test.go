@@ -0,0 +1,42 @@
+package manager
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func TestCheckReadinessCachesProbes(t *testing.T) {
+	var probes int32
+	filter := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&probes, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer filter.Close()
+
+	previous := LoadLiveConfig()
+	defer currentConfig.Store(previous)
+	currentConfig.Store(&LiveConfig{fields: ConfigFileFields{Prefilters: []model.FilterData{{Name: "http", Endpoint: filter.URL, Required: true}}}})
+	setConfigLoaded()
+	probeResults.Purge()
+	defer probeResults.Purge()
+
+	for i := 0; i < 3; i++ {
+		ready, checks := CheckReadiness()
+		if ready || len(checks) != 2 || checks[1].OK || checks[1].Error != "answered 503 Service Unavailable" {
+			t.Fatalf("got ready %v, checks %+v, want the filter check failed", ready, checks)
+		}
+	}
+	if got := atomic.LoadInt32(&probes); got != 1 {
+		t.Errorf("filter probed %v times, want 1", got)
+	}
+
+	probeResults.Purge()
+	CheckReadiness()
+	if got := atomic.LoadInt32(&probes); got != 2 {
+		t.Errorf("filter probed %v times after the cache was purged, want 2", got)
+	}
+}
@@ -0,0 +1,135 @@
+package manager
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//apiVersionRegexp matches Rancher API versions like v1, v2-beta or v3
+var apiVersionRegexp = regexp.MustCompile(`^v[0-9]+(-[a-z0-9]+)?$`)
+
+//ParseResource reads the API version, resource type/id and action from a Rancher API URL
+func ParseResource(apiPath string, query url.Values) model.Resource {
+	resource := model.Resource{Action: query.Get("action")}
+
+	var segments []string
+	for _, segment := range strings.Split(apiPath, "/") {
+		if segment != "" {
+			segments = append(segments, segment)
+		}
+	}
+	if len(segments) > 0 && apiVersionRegexp.MatchString(segments[0]) {
+		resource.APIVersion = segments[0]
+		segments = segments[1:]
+	}
+	//drop the environment scope of /projects/<id>/<type>/...
+	if len(segments) > 2 && (segments[0] == "projects" || segments[0] == "project") {
+		segments = segments[2:]
+	}
+	if len(segments) == 0 {
+		return resource
+	}
+
+	//the last type[/id] pair is the target, earlier pairs are parents of a link
+	last := (len(segments) - 1) / 2 * 2
+	resource.ResourceType = singular(segments[last])
+	if last+1 < len(segments) {
+		resource.ResourceID = segments[last+1]
+	} else {
+		resource.Collection = true
+	}
+	return resource
+}
+
+//ResourceAction returns the action a request performs on a resource: the ?action= if
+//present, otherwise create, update, delete, list or get depending on the method
+func ResourceAction(method string, resource model.Resource) string {
+	if resource.Action != "" {
+		return resource.Action
+	}
+	switch strings.ToUpper(method) {
+	case "POST":
+		return "create"
+	case "PUT", "PATCH":
+		return "update"
+	case "DELETE":
+		return "delete"
+	case "GET", "HEAD":
+		if resource.Collection {
+			return "list"
+		}
+		return "get"
+	}
+	return ""
+}
+
+//MatchesResource reports if the resources of a selector match the request
+func MatchesResource(selector model.RequestSelector, method string, resource model.Resource) bool {
+	if len(selector.Resources) == 0 || resource.ResourceType == "" || !matchesMethod(selector.Methods, method) {
+		return false
+	}
+	action := ResourceAction(method, resource)
+	for _, resourceSelector := range selector.Resources {
+		//config uses resource types like loadBalancerService, URLs use loadbalancerservices
+		if !strings.EqualFold(singular(resourceSelector.Type), resource.ResourceType) {
+			continue
+		}
+		if len(resourceSelector.Actions) == 0 {
+			return true
+		}
+		for _, selectorAction := range resourceSelector.Actions {
+			if strings.EqualFold(selectorAction, action) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//MatchesRequest reports if a selector matches the request by path template or by resource
+func MatchesRequest(selector model.RequestSelector, path string, method string, resource model.Resource) bool {
+	if MatchesResource(selector, method, resource) {
+		return true
+	}
+	if path == "" || !matchesMethod(selector.Methods, method) {
+		return false
+	}
+	for _, selectorPath := range selector.Paths {
+		if selectorPath == path {
+			return true
+		}
+	}
+	return false
+}
+
+//matchesMethod reports if method is one of methods, an empty list matches every method
+func matchesMethod(methods []string, method string) bool {
+	if len(methods) == 0 {
+		return true
+	}
+	for _, m := range methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+//singular turns a Rancher collection name like "services" or "registries" into its resource type
+func singular(collection string) string {
+	switch {
+	case strings.HasSuffix(collection, "ies"):
+		return strings.TrimSuffix(collection, "ies") + "y"
+	case strings.HasSuffix(collection, "sses"), strings.HasSuffix(collection, "xes"),
+		strings.HasSuffix(collection, "ches"), strings.HasSuffix(collection, "shes"):
+		return strings.TrimSuffix(collection, "es")
+	case strings.HasSuffix(collection, "ss"):
+		return collection
+	case strings.HasSuffix(collection, "s"):
+		return strings.TrimSuffix(collection, "s")
+	}
+	return collection
+}
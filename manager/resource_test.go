@@ -0,0 +1,74 @@
+package manager
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func TestParseResource(t *testing.T) {
+	tests := []struct {
+		path  string
+		query string
+		want  model.Resource
+	}{
+		{"/v2-beta/projects/1a5/services", "", model.Resource{APIVersion: "v2-beta", ResourceType: "service", Collection: true}},
+		{"/v2-beta/projects/1a5/services/1s3", "action=upgrade", model.Resource{APIVersion: "v2-beta", ResourceType: "service", ResourceID: "1s3", Action: "upgrade"}},
+		{"/v1/projects/1a5/stacks/1st2/services", "", model.Resource{APIVersion: "v1", ResourceType: "service", Collection: true}},
+		{"/v2-beta/projects/1a5", "", model.Resource{APIVersion: "v2-beta", ResourceType: "project", ResourceID: "1a5"}},
+		{"/v2-beta/registries/1sr1", "", model.Resource{APIVersion: "v2-beta", ResourceType: "registry", ResourceID: "1sr1"}},
+		{"/v3/clusters", "", model.Resource{APIVersion: "v3", ResourceType: "cluster", Collection: true}},
+		{"/v2-beta", "", model.Resource{APIVersion: "v2-beta"}},
+		{"/healthcheck", "", model.Resource{ResourceType: "healthcheck", Collection: true}},
+	}
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		if got := ParseResource(test.path, query); got != test.want {
+			t.Errorf("ParseResource(%v?%v) = %+v, want %+v", test.path, test.query, got, test.want)
+		}
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := map[string]string{
+		"services":                 "service",
+		"registries":               "registry",
+		"processes":                "process",
+		"boxes":                    "box",
+		"patches":                  "patch",
+		"meshes":                   "mesh",
+		"class":                    "class",
+		"loadbalancerservices":     "loadbalancerservice",
+		"environment":              "environment",
+		"registrationtokens":       "registrationtoken",
+		"serviceconsumemaps":       "serviceconsumemap",
+		"externalhandlerprocesses": "externalhandlerprocess",
+	}
+	for collection, want := range tests {
+		if got := singular(collection); got != want {
+			t.Errorf("singular(%v) = %v, want %v", collection, got, want)
+		}
+	}
+}
+
+func TestResourceAction(t *testing.T) {
+	tests := []struct {
+		method   string
+		resource model.Resource
+		want     string
+	}{
+		{"POST", model.Resource{Collection: true}, "create"},
+		{"POST", model.Resource{ResourceID: "1s1", Action: "upgrade"}, "upgrade"},
+		{"PUT", model.Resource{ResourceID: "1s1"}, "update"},
+		{"DELETE", model.Resource{ResourceID: "1s1"}, "delete"},
+		{"GET", model.Resource{Collection: true}, "list"},
+		{"get", model.Resource{ResourceID: "1s1"}, "get"},
+		{"OPTIONS", model.Resource{ResourceID: "1s1"}, ""},
+	}
+	for _, test := range tests {
+		if got := ResourceAction(test.method, test.resource); got != test.want {
+			t.Errorf("ResourceAction(%v, %+v) = %v, want %v", test.method, test.resource, got, test.want)
+		}
+	}
+}
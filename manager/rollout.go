@@ -0,0 +1,72 @@
+package manager
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+const (
+	rolloutHashByEnvID   = "envID"
+	rolloutHashByCaller  = "caller"
+	rolloutHashByRequest = "request"
+	//rolloutBuckets allows percentages with two decimals
+	rolloutBuckets = 10000
+)
+
+var rolloutRequests = metrics.NewCounterVec(
+	"api_filter_proxy_rollout_requests_total",
+	"Requests selected by a filter with a rollout, by bucket in (filter called) or out (filter skipped)",
+	"filter", "bucket",
+)
+
+func validateRollout(rollout *model.RolloutConfig) error {
+	if rollout == nil {
+		return nil
+	}
+	if rollout.Percentage < 0 || rollout.Percentage > 100 {
+		return fmt.Errorf("rollout percentage %v is not between 0 and 100", rollout.Percentage)
+	}
+	switch rollout.HashBy {
+	case "", rolloutHashByEnvID, rolloutHashByCaller, rolloutHashByRequest:
+		return nil
+	}
+	return fmt.Errorf("rollout hashBy %v is not one of envID, caller or request", rollout.HashBy)
+}
+
+//inRollout reports if the filter applies to the request. Requests are hashed by envID or caller
+//so an environment or a user always gets the same behavior for a given percentage.
+func inRollout(filterData model.FilterData, request model.APIRequestData, headers map[string][]string) bool {
+	rollout := filterData.Rollout
+	if rollout == nil {
+		return true
+	}
+
+	var key string
+	switch rollout.HashBy {
+	case rolloutHashByCaller:
+		if request.Identity != nil && request.Identity.AccountID != "" {
+			key = request.Identity.AccountID
+		} else {
+			key, _ = callerCredential(headers)
+		}
+	case rolloutHashByRequest:
+		key = request.RolloutKey
+	default:
+		key = request.EnvID
+	}
+
+	//the filter is part of the hash so different filters do not roll out to the same environments first
+	hash := fnv.New64a()
+	hash.Write([]byte(filterLabel(filterData) + "\x00" + key))
+	in := float64(hash.Sum64()%rolloutBuckets) < rollout.Percentage*rolloutBuckets/100
+
+	bucket := "out"
+	if in {
+		bucket = "in"
+	}
+	rolloutRequests.Inc(filterLabel(filterData), bucket)
+	return in
+}
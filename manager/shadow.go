@@ -0,0 +1,59 @@
+package manager
+
+import (
+	"encoding/json"
+
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+var shadowDecisions = metrics.NewCounterVec(
+	"api_filter_proxy_shadow_decisions_total",
+	"Decisions of filters running with enforce false, mutate is an allow that would have changed the request",
+	"filter", "decision",
+)
+
+//isEnforced reports if the filter decisions are applied, the default
+func isEnforced(filter model.FilterData) bool {
+	return filter.Enforce == nil || *filter.Enforce
+}
+
+//filterLabel names a filter in logs and metrics
+func filterLabel(filter model.FilterData) string {
+	if filter.Endpoint != "" {
+		return filter.Endpoint
+	}
+	return filter.Name
+}
+
+//shadowDecision completes the decision of a filter in shadow mode with the changes it would have made
+func shadowDecision(filterData model.FilterData, decision model.FilterDecision, request model.APIRequestData, responseData model.APIRequestData, body map[string]interface{}, headers map[string][]string) model.FilterDecision {
+	decision.Shadow = true
+	logger := util.RequestLogger(request.UUID)
+	outcome := decision.Decision
+	if decision.Decision == model.DecisionAllow {
+		changedBody, changedHeaders, err := applyFilterResponse(logger, filterData, responseData, body, headers)
+		if err != nil {
+			logger.Infof("Shadow filter %v returned patches that do not apply: %v", filterLabel(filterData), err)
+			decision.Decision = model.DecisionError
+			outcome = model.DecisionError
+		} else {
+			decision.BodyDiff = util.DiffJSON(body, changedBody)
+			decision.HeaderDiff = util.DiffHeaders(headers, changedHeaders)
+			decision.Destination = responseData.Destination
+			if len(decision.BodyDiff) > 0 || len(decision.HeaderDiff) > 0 || decision.Destination != "" {
+				outcome = "mutate"
+			}
+		}
+	}
+	shadowDecisions.Inc(filterLabel(filterData), outcome)
+
+	changes, _ := json.Marshal(struct {
+		BodyDiff    []model.JSONPatchOperation `json:"bodyDiff,omitempty"`
+		HeaderDiff  []model.HeaderOperation    `json:"headerDiff,omitempty"`
+		Destination string                     `json:"destination,omitempty"`
+	}{util.RedactJSONPatch(decision.BodyDiff), util.RedactHeaderOperations(decision.HeaderDiff), decision.Destination})
+	logger.Infof("Shadow filter %v would %v request %v %v (status %v), changes %s", filterLabel(filterData), outcome, request.Method, request.APIPath, decision.Status, changes)
+	return decision
+}
@@ -0,0 +1,84 @@
+package manager
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func TestValidateConfig(t *testing.T) {
+	httpFilter := func(endpoint string, paths []string, methods []string) model.FilterData {
+		return model.FilterData{Name: "http", Endpoint: endpoint, RequestSelector: model.RequestSelector{Paths: paths, Methods: methods}}
+	}
+	tests := []struct {
+		name    string
+		config  ConfigFileFields
+		wantErr bool
+	}{
+		{"valid", ConfigFileFields{
+			Prefilters:   []model.FilterData{httpFilter("http://policy/filter", []string{"/v2-beta/projects"}, []string{"POST"})},
+			Destinations: []Destination{{DestinationURL: "https://cattle:8080/", Paths: []string{"/v2-beta/projects"}}},
+		}, false},
+		{"http filter without endpoint", ConfigFileFields{
+			Prefilters: []model.FilterData{httpFilter("", []string{"/v2-beta/projects"}, []string{"POST"})},
+		}, true},
+		{"unknown filter without endpoint", ConfigFileFields{
+			Prefilters: []model.FilterData{{Name: "opa", RequestSelector: model.RequestSelector{Paths: []string{"/v2-beta/projects"}, Methods: []string{"POST"}}}},
+		}, true},
+		{"paths without methods", ConfigFileFields{
+			Prefilters: []model.FilterData{httpFilter("http://policy/filter", []string{"/v2-beta/projects"}, nil)},
+		}, true},
+		{"notifier paths without methods", ConfigFileFields{
+			Notifiers: []model.NotifierData{{Endpoint: "http://hook", RequestSelector: model.RequestSelector{Paths: []string{"/v2-beta/projects"}}}},
+		}, true},
+		{"empty destination URL", ConfigFileFields{
+			Destinations: []Destination{{Paths: []string{"/v2-beta/projects"}}},
+		}, true},
+		{"unparseable destination URL", ConfigFileFields{
+			Destinations: []Destination{{DestinationURL: "http://cattle:port/"}},
+		}, true},
+		{"destination URL without host", ConfigFileFields{
+			Destinations: []Destination{{DestinationURL: "http:/cattle/v2"}},
+		}, true},
+	}
+	for _, test := range tests {
+		assignConfigIDs(&test.config)
+		if err := validateConfig(test.config); (err != nil) != test.wantErr {
+			t.Errorf("%v: got %v, want error %v", test.name, err, test.wantErr)
+		}
+	}
+}
+
+func TestWriteConfigFileRefusesSymlink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	target := filepath.Join(dir, "config-data.json")
+	if err := ioutil.WriteFile(target, []byte("{}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "config.json")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	previous := configFile
+	defer func() { configFile = previous }()
+	configFile = link
+	if _, err := writeConfigFile(ConfigFileFields{}); err != errConfigSymlink {
+		t.Fatalf("got %v, want errConfigSymlink", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("the symlink was replaced")
+	}
+
+	configFile = target
+	if _, err := writeConfigFile(ConfigFileFields{}); err != nil {
+		t.Errorf("got %v writing a plain config file", err)
+	}
+}
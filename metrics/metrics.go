@@ -0,0 +1,271 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//collector is a metric family written in the Prometheus text format
+type collector interface {
+	name() string
+	write(w io.Writer)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []collector
+)
+
+func register(c collector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry = append(registry, c)
+}
+
+//Handler serves every registered metric in the Prometheus text format
+func Handler(w http.ResponseWriter, r *http.Request) {
+	registryMu.Lock()
+	collectors := append([]collector{}, registry...)
+	registryMu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+//labelSet holds the values of one series of a vector
+type labelSet struct {
+	key    string
+	values []string
+}
+
+func newLabelSet(labelNames []string, values []string) labelSet {
+	if len(values) != len(labelNames) {
+		panic(fmt.Sprintf("metrics: expected %v label values, got %v", len(labelNames), len(values)))
+	}
+	return labelSet{key: strings.Join(values, "\xff"), values: values}
+}
+
+//format renders {name="value",...}, extra is appended as is, like le="0.5"
+func (l labelSet) format(labelNames []string, extra string) string {
+	var pairs []string
+	for i, labelName := range labelNames {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", labelName, l.values[i]))
+	}
+	if extra != "" {
+		pairs = append(pairs, extra)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func writeHeader(w io.Writer, name string, help string, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+//CounterVec is a counter partitioned by labels
+type CounterVec struct {
+	metricName string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	series     map[string]*counterSeries
+}
+
+type counterSeries struct {
+	labels labelSet
+	value  float64
+}
+
+//NewCounterVec creates and registers a counter
+func NewCounterVec(name string, help string, labelNames ...string) *CounterVec {
+	c := &CounterVec{metricName: name, help: help, labelNames: labelNames, series: make(map[string]*counterSeries)}
+	register(c)
+	return c
+}
+
+//Inc adds one to the series with the given label values
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+//Add adds delta to the series with the given label values
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	labels := newLabelSet(c.labelNames, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	series, ok := c.series[labels.key]
+	if !ok {
+		series = &counterSeries{labels: labels}
+		c.series[labels.key] = series
+	}
+	series.value += delta
+}
+
+func (c *CounterVec) name() string {
+	return c.metricName
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	writeHeader(w, c.metricName, c.help, "counter")
+	for _, key := range sortedSeriesKeys(c.series) {
+		series := c.series[key]
+		fmt.Fprintf(w, "%s%s %v\n", c.metricName, series.labels.format(c.labelNames, ""), series.value)
+	}
+}
+
+func sortedSeriesKeys(series map[string]*counterSeries) []string {
+	var keys []string
+	for key := range series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//GaugeVec is a value that goes up and down, partitioned by labels
+type GaugeVec struct {
+	metricName string
+	help       string
+	labelNames []string
+	mu         sync.Mutex
+	series     map[string]*counterSeries
+}
+
+//NewGaugeVec creates and registers a gauge
+func NewGaugeVec(name string, help string, labelNames ...string) *GaugeVec {
+	g := &GaugeVec{metricName: name, help: help, labelNames: labelNames, series: make(map[string]*counterSeries)}
+	register(g)
+	return g
+}
+
+//Inc adds one to the series with the given label values
+func (g *GaugeVec) Inc(labelValues ...string) {
+	g.Add(1, labelValues...)
+}
+
+//Dec subtracts one from the series with the given label values
+func (g *GaugeVec) Dec(labelValues ...string) {
+	g.Add(-1, labelValues...)
+}
+
+//Set sets the series with the given label values to value
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	labels := newLabelSet(g.labelNames, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.series[labels.key] = &counterSeries{labels: labels, value: value}
+}
+
+//Add adds delta, which may be negative, to the series with the given label values
+func (g *GaugeVec) Add(delta float64, labelValues ...string) {
+	labels := newLabelSet(g.labelNames, labelValues)
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	series, ok := g.series[labels.key]
+	if !ok {
+		series = &counterSeries{labels: labels}
+		g.series[labels.key] = series
+	}
+	series.value += delta
+}
+
+func (g *GaugeVec) name() string {
+	return g.metricName
+}
+
+func (g *GaugeVec) write(w io.Writer) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	writeHeader(w, g.metricName, g.help, "gauge")
+	for _, key := range sortedSeriesKeys(g.series) {
+		series := g.series[key]
+		fmt.Fprintf(w, "%s%s %v\n", g.metricName, series.labels.format(g.labelNames, ""), series.value)
+	}
+}
+
+//DefaultBuckets are latency buckets in seconds, from 5ms to 10s
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//HistogramVec counts observations in buckets, partitioned by labels
+type HistogramVec struct {
+	metricName string
+	help       string
+	labelNames []string
+	buckets    []float64
+	mu         sync.Mutex
+	series     map[string]*histogramSeries
+}
+
+type histogramSeries struct {
+	labels labelSet
+	//counts holds the observations per bucket, not cumulated
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+//NewHistogramVec creates and registers a histogram, buckets must be sorted
+func NewHistogramVec(name string, help string, buckets []float64, labelNames ...string) *HistogramVec {
+	h := &HistogramVec{metricName: name, help: help, labelNames: labelNames, buckets: buckets, series: make(map[string]*histogramSeries)}
+	register(h)
+	return h
+}
+
+//Observe records value in the series with the given label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	labels := newLabelSet(h.labelNames, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	series, ok := h.series[labels.key]
+	if !ok {
+		series = &histogramSeries{labels: labels, counts: make([]uint64, len(h.buckets))}
+		h.series[labels.key] = series
+	}
+	for i, bound := range h.buckets {
+		if value <= bound {
+			series.counts[i]++
+			break
+		}
+	}
+	series.count++
+	series.sum += value
+}
+
+func (h *HistogramVec) name() string {
+	return h.metricName
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	writeHeader(w, h.metricName, h.help, "histogram")
+	var keys []string
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		series := h.series[key]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += series.counts[i]
+			le := fmt.Sprintf("le=%q", strconv.FormatFloat(bound, 'g', -1, 64))
+			fmt.Fprintf(w, "%s_bucket%s %v\n", h.metricName, series.labels.format(h.labelNames, le), cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %v\n", h.metricName, series.labels.format(h.labelNames, `le="+Inf"`), series.count)
+		fmt.Fprintf(w, "%s_sum%s %v\n", h.metricName, series.labels.format(h.labelNames, ""), series.sum)
+		fmt.Fprintf(w, "%s_count%s %v\n", h.metricName, series.labels.format(h.labelNames, ""), series.count)
+	}
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+//AuditConfig defines where the audit filter writes its records
+type AuditConfig struct {
+	//File is the path of the JSON lines file, rotated at MaxSizeMB keeping MaxBackups old files
+	File       string `json:"file,omitempty"`
+	MaxSizeMB  int    `json:"maxSizeMB,omitempty"`
+	MaxBackups int    `json:"maxBackups,omitempty"`
+	//Syslog is the path of a local syslog socket, "default" for the system one
+	Syslog    string `json:"syslog,omitempty"`
+	SyslogTag string `json:"syslogTag,omitempty"`
+	//IncludeBody adds the request body to the records, with the RedactFields JSONPaths masked
+	IncludeBody  bool     `json:"includeBody,omitempty"`
+	RedactFields []string `json:"redactFields,omitempty"`
+}
+
+//AuditRecord defines one line written by the audit filter
+type AuditRecord struct {
+	Time          time.Time              `json:"time"`
+	UUID          string                 `json:"UUID"`
+	Identity      *Identity              `json:"identity,omitempty"`
+	ClientAddress string                 `json:"clientAddress,omitempty"`
+	Method        string                 `json:"method"`
+	APIPath       string                 `json:"APIPath"`
+	EnvID         string                 `json:"envID,omitempty"`
+	Resource      Resource               `json:"resource"`
+	Decisions     []FilterDecision       `json:"decisions,omitempty"`
+	Status        int                    `json:"status"`
+	Body          map[string]interface{} `json:"body,omitempty"`
+}
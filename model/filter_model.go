@@ -4,13 +4,66 @@ import ()
 
 const SignatureHeader = "X-API-Auth-Signature"
 
+//OriginalCallerHeader carries the access key of the caller when the proxy replaces its credentials
+const OriginalCallerHeader = "X-API-Original-Caller"
+
+//RequestIDHeader correlates the logs of the proxy, the filters and the destination for a request
+const RequestIDHeader = "X-Request-Id"
+
 //FilterData defines the properties of a pre/post API filter
 type FilterData struct {
-	Name        string   `json:"name"`
-	Endpoint    string   `json:"endpoint"`
-	SecretToken string   `json:"secretToken"`
-	Methods     []string `json:"methods"`
-	Paths       []string `json:"paths"`
+	//ID names the filter in the admin API, derived from its settings when not set
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Endpoint    string `json:"endpoint"`
+	SecretToken string `json:"secretToken"`
+	RequestSelector
+	TLS *TLSConfig `json:"tls,omitempty"`
+	//Include restricts the parts of the request sent to the filter
+	Include *FilterInclude `json:"include,omitempty"`
+	//Enforce set to false runs the filter in shadow mode: it is called and its decision
+	//recorded, but the request always goes on unchanged
+	Enforce *bool `json:"enforce,omitempty"`
+	//Rollout applies the filter to a fraction of the requests only
+	Rollout *RolloutConfig `json:"rollout,omitempty"`
+	//Cache keeps the filter allow and deny decisions for repeated requests
+	Cache *DecisionCacheConfig `json:"cache,omitempty"`
+	//Audit configures the built-in audit filter
+	Audit *AuditConfig `json:"audit,omitempty"`
+	//Required makes the proxy readiness depend on the filter endpoint answering
+	Required bool `json:"required,omitempty"`
+	//ForwardCattleCredentials sends the proxy Cattle keys to the filter endpoint as Basic auth
+	ForwardCattleCredentials bool `json:"forwardCattleCredentials,omitempty"`
+}
+
+//RolloutConfig defines the fraction of requests a filter applies to
+type RolloutConfig struct {
+	//Percentage of the requests, 0 to 100
+	Percentage float64 `json:"percentage"`
+	//HashBy is envID (default), caller or request, and decides which requests share a bucket
+	HashBy string `json:"hashBy,omitempty"`
+}
+
+//DecisionCacheConfig defines how filter decisions are cached
+type DecisionCacheConfig struct {
+	//TTL is a duration like 30s
+	TTL        string `json:"ttl"`
+	MaxEntries int    `json:"maxEntries,omitempty"`
+	//KeyBy lists the request attributes of the cache key among caller, method, path and envID, all by default
+	KeyBy []string `json:"keyBy,omitempty"`
+}
+
+//FilterInclude defines which headers and body fields are sent to a filter
+type FilterInclude struct {
+	//Headers is an allowlist of header names, ExcludeHeaders a denylist
+	Headers        []string `json:"headers,omitempty"`
+	ExcludeHeaders []string `json:"excludeHeaders,omitempty"`
+	//Body set to false sends no body, it is sent by default
+	Body *bool `json:"body,omitempty"`
+	//BodyFields sends only the body fields selected by these JSONPath expressions
+	BodyFields []string `json:"bodyFields,omitempty"`
+	//Decisions sends the decisions of the earlier prefilters, they are not sent by default
+	Decisions bool `json:"decisions,omitempty"`
 }
 
 //APIRequestData defines the properties of a API Request/Response Body sent to/from a filter
@@ -21,4 +74,56 @@ type APIRequestData struct {
 	APIPath string                 `json:"APIPath,omitempty"`
 	EnvID   string                 `json:"envID,omitempty"`
 	Status  int                    `json:"status,omitempty"`
+	Method  string                 `json:"method,omitempty"`
+	Query   map[string][]string    `json:"query,omitempty"`
+	//ClientAddress is the IP address of the peer that sent the request to the proxy
+	ClientAddress string `json:"clientAddress,omitempty"`
+	//RouteTemplate is the filter path template the request matched, empty when selected by resource
+	RouteTemplate string            `json:"routeTemplate,omitempty"`
+	Vars          map[string]string `json:"vars,omitempty"`
+	//BodyPatch (RFC 6902), BodyMergePatch (RFC 7386) and HeaderPatch let a filter change
+	//parts of the request instead of returning the whole body or header map
+	BodyPatch      []JSONPatchOperation `json:"bodyPatch,omitempty"`
+	BodyMergePatch interface{}          `json:"bodyMergePatch,omitempty"`
+	HeaderPatch    []HeaderOperation    `json:"headerPatch,omitempty"`
+	//Decisions lists the outcome of the filters already called for the request
+	Decisions []FilterDecision `json:"decisions,omitempty"`
+	//Destination lets a filter route the request to another destinationURL listed in config.json
+	Destination string `json:"destination,omitempty"`
+	Resource
+	//Identity is the caller as resolved by Cattle, nil for anonymous or unknown callers
+	Identity *Identity `json:"identity,omitempty"`
+	//TraceParent is the W3C traceparent filters should send their calls with, not part of the filter payload
+	TraceParent string `json:"-"`
+	//TraceState is the W3C tracestate going along TraceParent
+	TraceState string `json:"-"`
+	//RolloutKey is generated by the proxy for every request, unlike the UUID clients can choose with X-Request-Id
+	RolloutKey string `json:"-"`
+}
+
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+	DecisionError = "error"
+)
+
+//FilterDecision defines the outcome of a filter call
+type FilterDecision struct {
+	Name     string `json:"name"`
+	Endpoint string `json:"endpoint,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	//Decision is one of allow, deny or error
+	Decision string `json:"decision"`
+	//Shadow is set for filters not enforced, the decision and changes below were not applied
+	Shadow      bool                 `json:"shadow,omitempty"`
+	BodyDiff    []JSONPatchOperation `json:"bodyDiff,omitempty"`
+	HeaderDiff  []HeaderOperation    `json:"headerDiff,omitempty"`
+	Destination string               `json:"destination,omitempty"`
+}
+
+//Identity defines the caller of an API request
+type Identity struct {
+	AccountID string   `json:"accountId,omitempty"`
+	Kind      string   `json:"kind,omitempty"`
+	Projects  []string `json:"projects,omitempty"`
 }
@@ -0,0 +1,19 @@
+package model
+
+//NotifierData defines a webhook called after the destination answered a request successfully
+type NotifierData struct {
+	Endpoint    string `json:"endpoint"`
+	SecretToken string `json:"secretToken"`
+	RequestSelector
+	TLS *TLSConfig `json:"tls,omitempty"`
+	//IncludeResponseBody adds the destination response body to the notification
+	IncludeResponseBody bool `json:"includeResponseBody,omitempty"`
+}
+
+//NotificationData defines the body sent to a notifier
+type NotificationData struct {
+	//Request holds the request metadata, without headers and body
+	Request      APIRequestData `json:"request"`
+	Status       int            `json:"status"`
+	ResponseBody interface{}    `json:"responseBody,omitempty"`
+}
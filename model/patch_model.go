@@ -0,0 +1,22 @@
+package model
+
+import (
+	"encoding/json"
+)
+
+//JSONPatchOperation is one RFC 6902 JSON Patch operation
+type JSONPatchOperation struct {
+	Op   string `json:"op"`
+	Path string `json:"path"`
+	From string `json:"from,omitempty"`
+	//Value is kept raw to tell a null value from a missing one
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+//HeaderOperation adds, sets or removes a request header
+type HeaderOperation struct {
+	//Op is one of add, set or remove
+	Op    string `json:"op"`
+	Name  string `json:"name"`
+	Value string `json:"value,omitempty"`
+}
@@ -4,4 +4,6 @@ package model
 type ProxyError struct {
 	Status  string `json:"status"`
 	Message string `json:"message"`
+	//RequestID is the X-Request-Id of the failed request
+	RequestID string `json:"requestId,omitempty"`
 }
@@ -0,0 +1,30 @@
+package model
+
+//ProjectIDHeader is the header Rancher clients use to scope a request to an environment
+const ProjectIDHeader = "X-API-Project-Id"
+
+//Resource defines the Rancher API resource targeted by a request
+type Resource struct {
+	APIVersion   string `json:"apiVersion,omitempty"`
+	ResourceType string `json:"resourceType,omitempty"`
+	ResourceID   string `json:"resourceId,omitempty"`
+	//Collection is true when the request targets a collection rather than a single resource
+	Collection bool `json:"collection,omitempty"`
+	//Action is the ?action= of the request, if any
+	Action string `json:"action,omitempty"`
+}
+
+//ResourceSelector matches requests on a resource type and, optionally, a list of actions.
+//Actions are create, update, delete, list, get or the name of a custom ?action=
+type ResourceSelector struct {
+	Type    string   `json:"type"`
+	Actions []string `json:"actions,omitempty"`
+}
+
+//RequestSelector defines the requests a filter or notifier applies to
+type RequestSelector struct {
+	Methods []string `json:"methods"`
+	Paths   []string `json:"paths"`
+	//Resources selects requests by Rancher resource type and action, across API versions
+	Resources []ResourceSelector `json:"resources,omitempty"`
+}
@@ -0,0 +1,503 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+const (
+	maxBackoff = 5 * time.Minute
+	//maxDeadLetters bounds the dead letters kept, the oldest are dropped first
+	maxDeadLetters = 1000
+	//maxWriteBatch bounds the notifications written to the queue dir with a single sync
+	maxWriteBatch = 256
+	//refillInterval is how often notifications waiting on disk are moved to the workers
+	refillInterval = time.Second
+)
+
+//Options configures the delivery queue
+type Options struct {
+	QueueSize   int
+	Workers     int
+	MaxAttempts int
+	//Backoff is the delay before the first retry, doubled on every further attempt
+	Backoff time.Duration
+	Timeout time.Duration
+	//QueueDir keeps pending notifications on disk so they survive a restart, in memory only when empty
+	QueueDir string
+}
+
+//Stats describes the state of the queue
+type Stats struct {
+	Depth       int          `json:"depth"`
+	DeadLetters []DeadLetter `json:"deadLetters"`
+}
+
+type delivery struct {
+	id string
+	//requestID is the request that triggered the notification, for the logs
+	requestID string
+	notifier  model.NotifierData
+	body      []byte
+	attempt   int
+}
+
+//Queue delivers notifications in the background with a bounded buffer and retries
+type Queue struct {
+	opts       Options
+	deliveries chan delivery
+	store      *walStore
+	//intake holds the notifications on their way to the queue dir, so clients never wait for the disk
+	intake chan delivery
+	//stopping is closed by Stop, persisted once persist wrote the intake and returned
+	stopping  chan struct{}
+	persisted chan struct{}
+	intakeMu  sync.RWMutex
+	stopped   bool
+
+	mu          sync.Mutex
+	pending     int
+	deadLetters []DeadLetter
+	//inFlight are the notifications of the store held by the workers or waiting for a retry
+	inFlight map[string]bool
+	//refill is set when notifications of the store did not fit in the deliveries channel
+	refill bool
+}
+
+var (
+	defaultQueue *Queue
+
+	notifiersMu sync.RWMutex
+	notifiers   map[string]model.NotifierData
+)
+
+//Start creates the process wide queue and its workers
+func Start(opts Options) error {
+	queue, err := NewQueue(opts)
+	if err != nil {
+		return err
+	}
+	defaultQueue = queue
+	return nil
+}
+
+//SetNotifiers records the configured notifiers. Notifications read back from the queue dir are
+//delivered with the settings of the notifier with the same endpoint.
+func SetNotifiers(configured []model.NotifierData) {
+	byEndpoint := make(map[string]model.NotifierData)
+	for _, notifier := range configured {
+		byEndpoint[notifier.Endpoint] = notifier
+	}
+	notifiersMu.Lock()
+	defer notifiersMu.Unlock()
+	notifiers = byEndpoint
+}
+
+func lookupNotifier(endpoint string) (model.NotifierData, bool) {
+	notifiersMu.RLock()
+	defer notifiersMu.RUnlock()
+	notifier, ok := notifiers[endpoint]
+	return notifier, ok
+}
+
+//Enqueue sends a notification through the process wide queue
+func Enqueue(notifier model.NotifierData, notification model.NotificationData) {
+	if defaultQueue == nil {
+		util.RequestLogger(notification.Request.UUID).Errorf("Notification for %v dropped, the notifier queue is not started", notifier.Endpoint)
+		return
+	}
+	defaultQueue.Enqueue(notifier, notification)
+}
+
+//Stop writes the notifications of the process wide queue not yet in the queue dir, see Queue.Stop
+func Stop(ctx context.Context) error {
+	if defaultQueue == nil {
+		return nil
+	}
+	return defaultQueue.Stop(ctx)
+}
+
+//GetStats returns the depth and dead letters of the process wide queue
+func GetStats() Stats {
+	if defaultQueue == nil {
+		return Stats{DeadLetters: []DeadLetter{}}
+	}
+	return defaultQueue.Stats()
+}
+
+//NewQueue creates a queue, replays the notifications left on disk and starts the workers
+func NewQueue(opts Options) (*Queue, error) {
+	if opts.QueueSize <= 0 {
+		opts.QueueSize = 1000
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = 1
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	q := &Queue{
+		opts:       opts,
+		deliveries: make(chan delivery, opts.QueueSize),
+		inFlight:   make(map[string]bool),
+	}
+
+	if opts.QueueDir != "" {
+		store, pending, err := openWALStore(opts.QueueDir)
+		if err != nil {
+			return nil, err
+		}
+		q.store = store
+		q.intake = make(chan delivery, opts.QueueSize)
+		q.stopping = make(chan struct{})
+		q.persisted = make(chan struct{})
+		//the notifications left on disk are handed to the workers like the ones that did not fit in memory
+		q.refill = len(pending) > 0
+		log.Infof("Notifier queue %v opened with %v pending notifications", store.path, len(pending))
+		go q.persist()
+		go q.refillLoop()
+	}
+
+	for i := 0; i < opts.Workers; i++ {
+		go q.work()
+	}
+	return q, nil
+}
+
+//Enqueue adds a notification to the queue, it never blocks nor waits for the disk until the queue is stopped.
+//When the queue is full the notification goes to the dead letters.
+func (q *Queue) Enqueue(notifier model.NotifierData, notification model.NotificationData) {
+	logger := util.RequestLogger(notification.Request.UUID)
+	body, err := json.Marshal(notification)
+	if err != nil {
+		logger.Errorf("Error marshalling the notification for %v: %v", notifier.Endpoint, err)
+		return
+	}
+	d := delivery{id: util.GenerateUUID(), requestID: notification.Request.UUID, notifier: notifier, body: body, attempt: 1}
+	if q.store == nil {
+		q.mu.Lock()
+		q.pending++
+		q.mu.Unlock()
+		q.push(d)
+		return
+	}
+
+	q.intakeMu.RLock()
+	defer q.intakeMu.RUnlock()
+	if q.stopped {
+		//persist is gone, the notification is written right away
+		q.persistBatch([]delivery{d})
+		return
+	}
+	select {
+	case q.intake <- d:
+	default:
+		logger.Errorf("Notifier queue full, dropping notification for %v", notifier.Endpoint)
+		//never written to the queue dir, the dead letter is kept in memory only
+		q.addDeadLetter(d, fmt.Errorf("notifier queue full"))
+	}
+}
+
+//Stop writes the notifications still in the intake to the queue dir, waiting for the batch being written,
+//at most until ctx is done. Notifications enqueued later are written before Enqueue returns.
+func (q *Queue) Stop(ctx context.Context) error {
+	if q.store == nil {
+		return nil
+	}
+	q.intakeMu.Lock()
+	if !q.stopped {
+		q.stopped = true
+		close(q.stopping)
+	}
+	q.intakeMu.Unlock()
+	select {
+	case <-q.persisted:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+//persist writes the notifications of the intake to the queue dir, batching the syncs, then hands them to the
+//workers. Once stopped it writes what is left in the intake and returns.
+func (q *Queue) persist() {
+	defer close(q.persisted)
+	for {
+		select {
+		case d := <-q.intake:
+			q.persistBatch(q.drainIntake([]delivery{d}))
+		case <-q.stopping:
+			for batch := q.drainIntake(nil); len(batch) > 0; batch = q.drainIntake(nil) {
+				q.persistBatch(batch)
+			}
+			return
+		}
+	}
+}
+
+//drainIntake adds the notifications waiting in the intake to batch, up to maxWriteBatch
+func (q *Queue) drainIntake(batch []delivery) []delivery {
+	for len(batch) < maxWriteBatch {
+		select {
+		case next := <-q.intake:
+			batch = append(batch, next)
+		default:
+			return batch
+		}
+	}
+	return batch
+}
+
+//persistBatch writes notifications to the queue dir with a single sync and hands them to the workers
+func (q *Queue) persistBatch(batch []delivery) {
+	records := make([]walRecord, 0, len(batch))
+	q.mu.Lock()
+	for _, d := range batch {
+		records = append(records, walRecord{Op: opEnqueue, ID: d.id, RequestID: d.requestID, Endpoint: d.notifier.Endpoint, Body: d.body})
+		//refillLoop must not pick them up from the store before they are pushed
+		q.inFlight[d.id] = true
+	}
+	q.mu.Unlock()
+	if err := q.store.writeBatch(records); err != nil {
+		log.Errorf("Error writing %v notifications to the queue, they will not survive a restart: %v", len(batch), err)
+	}
+
+	for _, d := range batch {
+		q.push(d)
+	}
+}
+
+//push hands a notification to the workers. When they are all busy and the queue is full, the
+//notification goes to the dead letters, or stays on disk for refillLoop when there is a queue dir.
+func (q *Queue) push(d delivery) {
+	if q.store == nil {
+		select {
+		case q.deliveries <- d:
+		default:
+			util.RequestLogger(d.requestID).Errorf("Notifier queue full, dropping notification for %v", d.notifier.Endpoint)
+			q.dead(d, fmt.Errorf("notifier queue full"))
+		}
+		return
+	}
+
+	q.mu.Lock()
+	q.inFlight[d.id] = true
+	q.mu.Unlock()
+	select {
+	case q.deliveries <- d:
+	default:
+		//safe in the queue dir, refillLoop hands it to the workers once they catch up
+		q.mu.Lock()
+		delete(q.inFlight, d.id)
+		q.refill = true
+		q.mu.Unlock()
+	}
+}
+
+//refillLoop moves the notifications waiting in the queue dir to the workers as they free up
+func (q *Queue) refillLoop() {
+	for {
+		q.refillOnce()
+		time.Sleep(refillInterval)
+	}
+}
+
+func (q *Queue) refillOnce() {
+	q.mu.Lock()
+	refill := q.refill
+	q.refill = false
+	q.mu.Unlock()
+	if !refill {
+		return
+	}
+
+	for _, record := range q.store.pendingRecords() {
+		q.mu.Lock()
+		inFlight := q.inFlight[record.ID]
+		if !inFlight {
+			q.inFlight[record.ID] = true
+		}
+		q.mu.Unlock()
+		if inFlight {
+			continue
+		}
+
+		d := delivery{id: record.ID, requestID: record.RequestID, body: record.Body, attempt: record.Attempts + 1}
+		if record.Attempts >= q.opts.MaxAttempts {
+			//stopped before it was recorded dead
+			d.notifier = model.NotifierData{Endpoint: record.Endpoint}
+			d.attempt = record.Attempts
+			q.dead(d, fmt.Errorf("%v", record.Error))
+			continue
+		}
+		notifier, ok := lookupNotifier(record.Endpoint)
+		if !ok {
+			d.notifier = model.NotifierData{Endpoint: record.Endpoint}
+			util.RequestLogger(d.requestID).Errorf("Giving up notification %v, notifier %v is not configured anymore", record.ID, record.Endpoint)
+			q.dead(d, fmt.Errorf("notifier %v is not configured anymore", record.Endpoint))
+			continue
+		}
+		d.notifier = notifier
+
+		select {
+		case q.deliveries <- d:
+		default:
+			//full again, the rest waits for the next round
+			q.mu.Lock()
+			delete(q.inFlight, d.id)
+			q.refill = true
+			q.mu.Unlock()
+			return
+		}
+	}
+}
+
+//Stats returns the number of notifications waiting for delivery and the dead letters
+func (q *Queue) Stats() Stats {
+	q.mu.Lock()
+	deadLetters := append([]DeadLetter{}, q.deadLetters...)
+	pending := q.pending
+	q.mu.Unlock()
+	if q.store != nil {
+		return Stats{Depth: q.store.depth() + len(q.intake), DeadLetters: append(q.store.dead(), deadLetters...)}
+	}
+	return Stats{Depth: pending, DeadLetters: deadLetters}
+}
+
+func (q *Queue) work() {
+	for d := range q.deliveries {
+		logger := util.RequestLogger(d.requestID)
+		err := q.deliver(logger, d)
+		if err == nil {
+			q.done(walRecord{Op: opAck, ID: d.id})
+			continue
+		}
+		if d.attempt >= q.opts.MaxAttempts {
+			logger.Errorf("Giving up notification for %v after %v attempts: %v", d.notifier.Endpoint, d.attempt, err)
+			q.dead(d, err)
+			continue
+		}
+		backoff := q.backoff(d.attempt)
+		logger.Warnf("Notification for %v failed (attempt %v), retrying in %v: %v", d.notifier.Endpoint, d.attempt, backoff, err)
+		q.recordAttempt(d, err)
+		d.attempt++
+		//the retry waits outside of the worker so other notifications keep flowing
+		retry := d
+		time.AfterFunc(backoff, func() { q.push(retry) })
+	}
+}
+
+//recordAttempt writes a failed attempt to the queue dir, a restart does not reset the attempts made
+func (q *Queue) recordAttempt(d delivery, err error) {
+	if q.store == nil {
+		return
+	}
+	if err := q.store.write(walRecord{Op: opAttempt, ID: d.id, Attempts: d.attempt, Error: err.Error()}); err != nil {
+		util.RequestLogger(d.requestID).Errorf("Error writing notification %v attempt to the queue: %v", d.id, err)
+	}
+}
+
+//dead moves a notification to the dead letters
+func (q *Queue) dead(d delivery, err error) {
+	if q.store == nil {
+		q.addDeadLetter(d, err)
+	}
+	q.done(walRecord{Op: opDead, ID: d.id, Attempts: d.attempt, Error: err.Error()})
+}
+
+//addDeadLetter keeps a dead letter in memory
+func (q *Queue) addDeadLetter(d delivery, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.deadLetters = appendDeadLetter(q.deadLetters, DeadLetter{
+		ID:           d.id,
+		Endpoint:     d.notifier.Endpoint,
+		Notification: d.body,
+		Attempts:     d.attempt,
+		Error:        err.Error(),
+		Time:         time.Now().UTC(),
+	})
+}
+
+//appendDeadLetter adds a dead letter, dropping the oldest beyond maxDeadLetters
+func appendDeadLetter(deadLetters []DeadLetter, deadLetter DeadLetter) []DeadLetter {
+	deadLetters = append(deadLetters, deadLetter)
+	if len(deadLetters) > maxDeadLetters {
+		deadLetters = append([]DeadLetter{}, deadLetters[len(deadLetters)-maxDeadLetters:]...)
+	}
+	return deadLetters
+}
+
+//done records that a notification left the queue, delivered or dead
+func (q *Queue) done(record walRecord) {
+	q.mu.Lock()
+	if q.store == nil {
+		q.pending--
+	}
+	delete(q.inFlight, record.ID)
+	q.mu.Unlock()
+	if q.store != nil {
+		if err := q.store.write(record); err != nil {
+			log.Errorf("Error writing notification %v state to the queue: %v", record.ID, err)
+		}
+	}
+}
+
+func (q *Queue) backoff(attempt int) time.Duration {
+	backoff := q.opts.Backoff
+	for i := 1; i < attempt && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	return backoff
+}
+
+func (q *Queue) deliver(logger *log.Entry, d delivery) error {
+	transport, err := util.GetTransport(d.notifier.TLS)
+	if err != nil {
+		return err
+	}
+	client := &http.Client{Transport: transport, Timeout: q.opts.Timeout}
+	req, err := http.NewRequest("POST", d.notifier.Endpoint, bytes.NewReader(d.body))
+	if err != nil {
+		return err
+	}
+	//sign the body
+	if d.notifier.SecretToken != "" {
+		req.Header.Set(model.SignatureHeader, util.SignString(d.body, []byte(d.notifier.SecretToken)))
+		logger.Debugf("Signed the notification %v for %v", d.id, d.notifier.Endpoint)
+	}
+	if d.requestID != "" {
+		req.Header.Set(model.RequestIDHeader, d.requestID)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Length", strconv.Itoa(len(d.body)))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("notifier answered %v", resp.Status)
+	}
+	return nil
+}
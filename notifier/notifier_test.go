@@ -0,0 +1,227 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//testNotifier counts the notifications it receives, the handler is held until release is closed
+type testNotifier struct {
+	server  *httptest.Server
+	release chan struct{}
+
+	mu         sync.Mutex
+	received   []string
+	signatures []string
+}
+
+func newTestNotifier() *testNotifier {
+	n := &testNotifier{release: make(chan struct{})}
+	n.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-n.release
+		body, _ := ioutil.ReadAll(r.Body)
+		n.mu.Lock()
+		n.received = append(n.received, string(body))
+		n.signatures = append(n.signatures, r.Header.Get(model.SignatureHeader))
+		n.mu.Unlock()
+	}))
+	return n
+}
+
+func (n *testNotifier) count() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return len(n.received)
+}
+
+func waitFor(t *testing.T, what string, condition func() bool) {
+	deadline := time.Now().Add(10 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %v", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestQueueKeepsOverflowOnDisk(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	target := newTestNotifier()
+	defer target.server.Close()
+
+	notifier := model.NotifierData{Endpoint: target.server.URL, SecretToken: "s3cr3t-token"}
+	SetNotifiers([]model.NotifierData{notifier})
+	queue, err := NewQueue(Options{QueueSize: 2, Workers: 1, MaxAttempts: 1, QueueDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//the worker holds one, two fit in the channel, the rest waits on disk
+	for i := 0; i < 6; i++ {
+		queue.Enqueue(notifier, model.NotificationData{Status: 200 + i})
+		time.Sleep(20 * time.Millisecond)
+	}
+	waitFor(t, "the notifications to be written", func() bool { return queue.Stats().Depth == 6 })
+	if dead := queue.Stats().DeadLetters; len(dead) != 0 {
+		t.Fatalf("got dead letters %+v, want none", dead)
+	}
+
+	close(target.release)
+	waitFor(t, "the notifications to be delivered", func() bool { return target.count() == 6 })
+	waitFor(t, "the queue to be empty", func() bool { return queue.Stats().Depth == 0 })
+	for _, signature := range target.signatures {
+		if signature == "" {
+			t.Errorf("notification delivered without signature")
+		}
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(dir, walFileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(content), notifier.SecretToken) {
+		t.Errorf("the queue file holds the notifier secret token")
+	}
+}
+
+func TestQueueReplaysAfterRestart(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	target := newTestNotifier()
+	close(target.release)
+	defer target.server.Close()
+
+	//left by a previous run, one for a notifier that is not configured anymore
+	store, _, err := openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.writeBatch([]walRecord{
+		{Op: opEnqueue, ID: "a", Endpoint: target.server.URL, Body: json.RawMessage(`{"status":201}`)},
+		{Op: opEnqueue, ID: "b", Endpoint: "http://127.0.0.1:1/removed", Body: json.RawMessage(`{"status":202}`)},
+		{Op: opEnqueue, ID: "c", Endpoint: target.server.URL, Body: json.RawMessage(`{"status":203}`)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.file.Close()
+
+	SetNotifiers([]model.NotifierData{{Endpoint: target.server.URL, SecretToken: "token"}})
+	queue, err := NewQueue(Options{QueueSize: 10, Workers: 1, MaxAttempts: 1, QueueDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the replayed notifications to be delivered", func() bool { return target.count() == 2 })
+	waitFor(t, "the queue to be empty", func() bool { return queue.Stats().Depth == 0 })
+
+	if target.received[0] != `{"status":201}` || target.received[1] != `{"status":203}` {
+		t.Errorf("got %v, want the notifications in enqueue order", target.received)
+	}
+	if target.signatures[0] == "" {
+		t.Errorf("replayed notification delivered without the signature of the configured notifier")
+	}
+	dead := queue.Stats().DeadLetters
+	if len(dead) != 1 || dead[0].ID != "b" {
+		t.Errorf("got dead letters %+v, want b only", dead)
+	}
+}
+
+func TestQueueInMemoryDeadLetters(t *testing.T) {
+	target := newTestNotifier()
+	defer target.server.Close()
+	defer close(target.release)
+
+	notifier := model.NotifierData{Endpoint: target.server.URL}
+	queue, err := NewQueue(Options{QueueSize: 1, Workers: 1, MaxAttempts: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the worker holds one, one fits in the channel, the third has nowhere to go
+	for i := 0; i < 3; i++ {
+		queue.Enqueue(notifier, model.NotificationData{Status: 200})
+		time.Sleep(20 * time.Millisecond)
+	}
+	dead := queue.Stats().DeadLetters
+	if len(dead) != 1 || dead[0].Endpoint != target.server.URL || dead[0].Error != "notifier queue full" {
+		t.Errorf("got dead letters %+v, want one for the full queue", dead)
+	}
+}
+
+func TestQueueStopWritesIntake(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	target := newTestNotifier()
+	defer target.server.Close()
+	defer close(target.release)
+
+	notifier := model.NotifierData{Endpoint: target.server.URL}
+	SetNotifiers([]model.NotifierData{notifier})
+	queue, err := NewQueue(Options{QueueSize: 100, Workers: 1, MaxAttempts: 1, QueueDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 50; i++ {
+		queue.Enqueue(notifier, model.NotificationData{Status: 200})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := queue.Stop(ctx); err != nil {
+		t.Fatal(err)
+	}
+	//enqueued after Stop, written right away
+	queue.Enqueue(notifier, model.NotificationData{Status: 201})
+
+	store, pending, err := openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.file.Close()
+	if len(pending) != 51 {
+		t.Errorf("got %v notifications in the queue dir, want 51", len(pending))
+	}
+}
+
+func TestQueueResumesAttemptsAfterRestart(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer failing.Close()
+
+	notifier := model.NotifierData{Endpoint: failing.URL}
+	SetNotifiers([]model.NotifierData{notifier})
+	queue, err := NewQueue(Options{QueueSize: 10, Workers: 1, MaxAttempts: 3, Backoff: time.Hour, QueueDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	queue.Enqueue(notifier, model.NotificationData{Status: 200})
+	//the first attempt failed, the retry waits an hour
+	waitFor(t, "the failed attempt to be written", func() bool {
+		records := queue.store.pendingRecords()
+		return len(records) == 1 && records[0].Attempts == 1
+	})
+	queue.store.file.Close()
+
+	//two more attempts after the restart, not three
+	queue, err = NewQueue(Options{QueueSize: 10, Workers: 1, MaxAttempts: 3, Backoff: time.Millisecond, QueueDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the notification to be given up", func() bool { return len(queue.Stats().DeadLetters) == 1 })
+	if dead := queue.Stats().DeadLetters[0]; dead.Attempts != 3 {
+		t.Errorf("given up after %v attempts, want 3", dead.Attempts)
+	}
+}
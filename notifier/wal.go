@@ -0,0 +1,243 @@
+package notifier
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	walFileName = "notifications.wal"
+	//compactEvery rewrites the log after this many delivered or dead notifications
+	compactEvery = 1000
+
+	opEnqueue = "enqueue"
+	//opAttempt records a failed delivery attempt, so retries resume from there after a restart
+	opAttempt = "attempt"
+	opAck     = "ack"
+	opDead    = "dead"
+)
+
+//DeadLetter is a notification that could not be delivered
+type DeadLetter struct {
+	ID string `json:"id"`
+	//Endpoint is the notifier the notification was for
+	Endpoint     string          `json:"endpoint"`
+	Notification json.RawMessage `json:"notification"`
+	Attempts     int             `json:"attempts"`
+	Error        string          `json:"error"`
+	Time         time.Time       `json:"time"`
+}
+
+//walRecord is one line of the write-ahead log. Notifiers are recorded by endpoint only, so their
+//secret token never reaches the disk, and are looked up in the config when the notification is delivered.
+type walRecord struct {
+	Op        string          `json:"op"`
+	ID        string          `json:"id"`
+	RequestID string          `json:"requestId,omitempty"`
+	Endpoint  string          `json:"endpoint,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	Attempts  int             `json:"attempts,omitempty"`
+	Error     string          `json:"error,omitempty"`
+	Time      time.Time       `json:"time"`
+}
+
+//walStore keeps pending and dead notifications in an append-only file so they survive a restart
+type walStore struct {
+	path        string
+	mu          sync.Mutex
+	file        *os.File
+	pending     map[string]walRecord
+	order       []string
+	deadLetters []DeadLetter
+	//removed counts the records made useless by an ack or a dead since the last compaction
+	removed int
+}
+
+//openWALStore replays the log in dir, the pending notifications are returned in enqueue order
+func openWALStore(dir string) (*walStore, []walRecord, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, nil, fmt.Errorf("Error creating notifier queue dir %v: %v", dir, err)
+	}
+	store := &walStore{
+		path:    filepath.Join(dir, walFileName),
+		pending: make(map[string]walRecord),
+	}
+	if err := store.replay(); err != nil {
+		return nil, nil, err
+	}
+	if err := store.compact(); err != nil {
+		return nil, nil, err
+	}
+
+	return store, store.pendingRecords(), nil
+}
+
+func (s *walStore) replay() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error opening notifier queue %v: %v", s.path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := walRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			//a torn last line after a crash, what was written before it is still good
+			log.Warnf("Skipping unreadable record in notifier queue %v: %v", s.path, err)
+			continue
+		}
+		s.apply(record)
+	}
+	return scanner.Err()
+}
+
+//apply updates the in-memory state with a record
+func (s *walStore) apply(record walRecord) {
+	switch record.Op {
+	case opEnqueue:
+		if _, exists := s.pending[record.ID]; !exists {
+			s.order = append(s.order, record.ID)
+		}
+		s.pending[record.ID] = record
+	case opAttempt:
+		enqueued, ok := s.pending[record.ID]
+		if !ok {
+			return
+		}
+		enqueued.Attempts = record.Attempts
+		enqueued.Error = record.Error
+		s.pending[record.ID] = enqueued
+		//the enqueue record carries the attempts once compacted
+		s.removed++
+	case opAck, opDead:
+		enqueued, ok := s.pending[record.ID]
+		if !ok {
+			return
+		}
+		delete(s.pending, record.ID)
+		for i, id := range s.order {
+			if id == record.ID {
+				s.order = append(s.order[:i], s.order[i+1:]...)
+				break
+			}
+		}
+		s.removed++
+		if record.Op == opDead {
+			s.deadLetters = appendDeadLetter(s.deadLetters, DeadLetter{
+				ID:           record.ID,
+				Endpoint:     enqueued.Endpoint,
+				Notification: enqueued.Body,
+				Attempts:     record.Attempts,
+				Error:        record.Error,
+				Time:         record.Time,
+			})
+		}
+	}
+}
+
+//compact rewrites the log with the pending and dead notifications only
+func (s *walStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmpFile, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Error compacting notifier queue %v: %v", s.path, err)
+	}
+	encoder := json.NewEncoder(tmpFile)
+	for _, dead := range s.deadLetters {
+		encoder.Encode(walRecord{Op: opEnqueue, ID: dead.ID, Endpoint: dead.Endpoint, Body: dead.Notification, Time: dead.Time})
+		encoder.Encode(walRecord{Op: opDead, ID: dead.ID, Attempts: dead.Attempts, Error: dead.Error, Time: dead.Time})
+	}
+	for _, id := range s.order {
+		encoder.Encode(s.pending[id])
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	tmpFile.Close()
+	if err := os.Rename(tmpPath, s.path); err != nil {
+		return fmt.Errorf("Error compacting notifier queue %v: %v", s.path, err)
+	}
+
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file, err = os.OpenFile(s.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Error opening notifier queue %v: %v", s.path, err)
+	}
+	s.removed = 0
+	return nil
+}
+
+//write appends a record and syncs it to disk before returning
+func (s *walStore) write(record walRecord) error {
+	return s.writeBatch([]walRecord{record})
+}
+
+//writeBatch appends records with a single sync to disk before returning
+func (s *walStore) writeBatch(records []walRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var lines []byte
+	now := time.Now().UTC()
+	for i := range records {
+		records[i].Time = now
+		line, err := json.Marshal(records[i])
+		if err != nil {
+			return err
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if _, err := s.file.Write(lines); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+	for _, record := range records {
+		s.apply(record)
+	}
+	if s.removed >= compactEvery {
+		if err := s.compact(); err != nil {
+			log.Errorf("%v", err)
+		}
+	}
+	return nil
+}
+
+//depth returns the number of notifications waiting for delivery
+func (s *walStore) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.order)
+}
+
+//pendingRecords returns the notifications waiting for delivery in enqueue order
+func (s *walStore) pendingRecords() []walRecord {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make([]walRecord, 0, len(s.order))
+	for _, id := range s.order {
+		records = append(records, s.pending[id])
+	}
+	return records
+}
+
+func (s *walStore) dead() []DeadLetter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter{}, s.deadLetters...)
+}
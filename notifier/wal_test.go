@@ -0,0 +1,101 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func tempQueueDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "notifier-queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func TestWALStoreReplay(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	store, pending, err := openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Fatalf("new queue has %v pending notifications", len(pending))
+	}
+	records := []walRecord{
+		{Op: opEnqueue, ID: "a", Endpoint: "http://a", Body: json.RawMessage(`{"n":1}`)},
+		{Op: opEnqueue, ID: "b", Endpoint: "http://b", Body: json.RawMessage(`{"n":2}`)},
+		{Op: opEnqueue, ID: "c", Endpoint: "http://c", Body: json.RawMessage(`{"n":3}`)},
+		{Op: opAck, ID: "a"},
+		{Op: opDead, ID: "b", Attempts: 3, Error: "notifier answered 500"},
+		//acks of unknown notifications are ignored
+		{Op: opAck, ID: "x"},
+	}
+	if err := store.writeBatch(records); err != nil {
+		t.Fatal(err)
+	}
+	store.file.Close()
+
+	//a torn last line, as left by a crash in the middle of a write
+	file, err := os.OpenFile(filepath.Join(dir, walFileName), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.WriteString(`{"op":"enqueue","id":"d","endp`)
+	file.Close()
+
+	store, pending, err = openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.file.Close()
+	if len(pending) != 1 || pending[0].ID != "c" || pending[0].Endpoint != "http://c" || string(pending[0].Body) != `{"n":3}` {
+		t.Errorf("got pending %+v, want c only", pending)
+	}
+	dead := store.dead()
+	if len(dead) != 1 || dead[0].ID != "b" || dead[0].Endpoint != "http://b" || dead[0].Attempts != 3 || dead[0].Error != "notifier answered 500" {
+		t.Errorf("got dead letters %+v, want b only", dead)
+	}
+	if store.depth() != 1 {
+		t.Errorf("got depth %v, want 1", store.depth())
+	}
+}
+
+func TestWALStoreCapsDeadLetters(t *testing.T) {
+	dir := tempQueueDir(t)
+	defer os.RemoveAll(dir)
+
+	store, _, err := openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []walRecord
+	for i := 0; i < maxDeadLetters+10; i++ {
+		id := fmt.Sprintf("n%v", i)
+		records = append(records, walRecord{Op: opEnqueue, ID: id, Endpoint: "http://a", Body: json.RawMessage(`{}`)})
+		records = append(records, walRecord{Op: opDead, ID: id, Attempts: 1, Error: "failed"})
+	}
+	if err := store.writeBatch(records); err != nil {
+		t.Fatal(err)
+	}
+	store.file.Close()
+
+	store, _, err = openWALStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.file.Close()
+	dead := store.dead()
+	if len(dead) != maxDeadLetters {
+		t.Fatalf("got %v dead letters, want %v", len(dead), maxDeadLetters)
+	}
+	if dead[0].ID != "n10" {
+		t.Errorf("oldest dead letter kept is %v, want n10", dead[0].ID)
+	}
+}
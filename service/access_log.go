@@ -0,0 +1,103 @@
+package service
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+var (
+	accessLogMu sync.Mutex
+	accessLog   io.Writer
+)
+
+//accessLogRecord is one line of the access log
+type accessLogRecord struct {
+	Time        time.Time `json:"time"`
+	RequestID   string    `json:"requestId"`
+	ClientIP    string    `json:"clientIp"`
+	Method      string    `json:"method"`
+	Path        string    `json:"path"`
+	Route       string    `json:"route"`
+	Status      int       `json:"status"`
+	Bytes       int64     `json:"bytes"`
+	LatencyMs   float64   `json:"latencyMs"`
+	FilterMs    float64   `json:"filterMs"`
+	Destination string    `json:"destination,omitempty"`
+}
+
+//SetAccessLog writes one JSON line per request to stdout when target is "-" or "stdout", else to
+//the file target rotated at maxBytes. An empty target turns the access log off.
+func SetAccessLog(target string, maxBytes int64, maxBackups int) error {
+	var writer io.Writer
+	switch target {
+	case "":
+	case "-", "stdout":
+		writer = os.Stdout
+	default:
+		file, err := util.NewRotatingFile(target, maxBytes, maxBackups)
+		if err != nil {
+			return err
+		}
+		writer = file
+	}
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+	accessLog = writer
+	return nil
+}
+
+//writeAccessLog records a served request
+func writeAccessLog(r *http.Request, info *requestInfo, recorder *statusRecorder, start time.Time, latency time.Duration) {
+	if currentAccessLog() == nil {
+		return
+	}
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		clientIP = r.RemoteAddr
+	}
+	line, err := json.Marshal(accessLogRecord{
+		Time:        start.UTC(),
+		RequestID:   r.Header.Get(model.RequestIDHeader),
+		ClientIP:    clientIP,
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Route:       info.route,
+		Status:      recorder.Status(),
+		Bytes:       recorder.Bytes(),
+		LatencyMs:   milliseconds(latency),
+		FilterMs:    milliseconds(info.filterTime),
+		Destination: info.destination,
+	})
+	if err != nil {
+		log.Errorf("Error marshalling the access log record: %v", err)
+		return
+	}
+	//only the write is serialized, requests build their lines concurrently
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+	if accessLog == nil {
+		return
+	}
+	if _, err := accessLog.Write(append(line, '\n')); err != nil {
+		log.Errorf("Error writing the access log: %v", err)
+	}
+}
+
+func currentAccessLog() io.Writer {
+	accessLogMu.Lock()
+	defer accessLogMu.Unlock()
+	return accessLog
+}
+
+func milliseconds(duration time.Duration) float64 {
+	return float64(duration) / float64(time.Millisecond)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//routeView is a route of the proxy with where its requests go
+type routeView struct {
+	Method            string                    `json:"method"`
+	Path              string                    `json:"path"`
+	Filters           []manager.ExplainedFilter `json:"filters"`
+	Notifiers         []string                  `json:"notifiers"`
+	Destination       string                    `json:"destination"`
+	CattleCredentials string                    `json:"cattleCredentials,omitempty"`
+}
+
+//resourceRouteView is a resource selector of a prefilter or notifier, served by the {resource} route
+type resourceRouteView struct {
+	Filter    string                   `json:"filter,omitempty"`
+	Notifier  string                   `json:"notifier,omitempty"`
+	Methods   []string                 `json:"methods,omitempty"`
+	Resources []model.ResourceSelector `json:"resources"`
+}
+
+//explainView tells how a request is handled: by an admin endpoint, through the filters after matching
+//a path or a resource, or proxied as is to the default destination when unmatched
+type explainView struct {
+	Match string `json:"match"`
+	Path  string `json:"path"`
+	*manager.Explanation
+}
+
+func writeJSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	jsonStr, err := json.Marshal(v)
+	if err != nil {
+		log.Errorf("Error marshalling the response of %v: %v", r.URL.Path, err)
+		ReturnHTTPError(w, r, http.StatusInternalServerError, "Failed to marshal the response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonStr)
+}
+
+func showConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, manager.MaskedConfig(manager.LoadLiveConfig().Fields()))
+}
+
+func showRoutes(w http.ResponseWriter, r *http.Request) {
+	config := manager.LoadLiveConfig()
+	configFields := config.Fields()
+
+	var admin []string
+	for _, route := range adminRoutes() {
+		admin = append(admin, route.method+" "+route.path)
+	}
+
+	routes := []routeView{}
+	for _, route := range proxyRoutes(requestSelectors(configFields)) {
+		explanation := config.Explain(route.path, route.method, model.Resource{})
+		routes = append(routes, routeView{
+			Method:            route.method,
+			Path:              route.path,
+			Filters:           explanation.Filters,
+			Notifiers:         explanation.Notifiers,
+			Destination:       explanation.Destination,
+			CattleCredentials: explanation.CattleCredentials,
+		})
+	}
+
+	resources := []resourceRouteView{}
+	for _, filter := range configFields.Prefilters {
+		if len(filter.Resources) > 0 {
+			resources = append(resources, resourceRouteView{Filter: filter.Endpoint, Methods: filter.Methods, Resources: filter.Resources})
+		}
+	}
+	for _, notifier := range configFields.Notifiers {
+		if len(notifier.Resources) > 0 {
+			resources = append(resources, resourceRouteView{Notifier: notifier.Endpoint, Methods: notifier.Methods, Resources: notifier.Resources})
+		}
+	}
+
+	writeJSON(w, r, struct {
+		Admin              []string            `json:"admin"`
+		Routes             []routeView         `json:"routes"`
+		Resources          []resourceRouteView `json:"resources"`
+		DefaultDestination string              `json:"defaultDestination"`
+	}{admin, routes, resources, manager.DefaultDestination})
+}
+
+//explain runs the router on a made up request to show what would happen to it, without sending it anywhere
+func explain(w http.ResponseWriter, r *http.Request) {
+	method := strings.ToUpper(r.URL.Query().Get("method"))
+	path := r.URL.Query().Get("path")
+	if method == "" {
+		method = "GET"
+	}
+	if !strings.HasPrefix(path, "/") {
+		ReturnHTTPError(w, r, http.StatusBadRequest, "The path parameter must be an absolute request path like /v2-beta/projects/1a5/services")
+		return
+	}
+	req, err := http.NewRequest(method, path, nil)
+	if err != nil {
+		ReturnHTTPError(w, r, http.StatusBadRequest, "Invalid method or path: "+err.Error())
+		return
+	}
+
+	//the router of the same config the explanation comes from
+	config := manager.LoadLiveConfig()
+	view := explainView{Path: req.URL.Path}
+	var match mux.RouteMatch
+	if !NewRouter(config.Fields()).Match(req, &match) || match.Route == nil {
+		//unmatched requests are proxied as they are
+		view.Match = "unmatched"
+		view.Explanation = &manager.Explanation{Method: method, Filters: []manager.ExplainedFilter{}, Notifiers: []string{}, Destination: manager.DefaultDestination}
+		writeJSON(w, r, view)
+		return
+	}
+
+	view.Match = match.Route.GetName()
+	switch view.Match {
+	case pathRouteName:
+		routeTemplate, _ := match.Route.GetPathTemplate()
+		explanation := config.Explain(routeTemplate, method, manager.ParseResource(req.URL.Path, req.URL.Query()))
+		view.Explanation = &explanation
+	case resourceRouteName:
+		explanation := config.Explain("", method, manager.ParseResource(req.URL.Path, req.URL.Query()))
+		view.Explanation = &explanation
+	}
+	writeJSON(w, r, view)
+}
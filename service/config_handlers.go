@@ -0,0 +1,243 @@
+package service
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gorilla/mux"
+
+	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//AdminTokenHeader carries the token allowing config changes through the admin API
+const AdminTokenHeader = "X-API-Admin-Token"
+
+//AdminAPIToken must be sent in AdminTokenHeader to change the config, changes are refused when empty
+var AdminAPIToken string
+
+//requireAdminToken only lets requests with the admin token through to handler, it guards the endpoints that
+//change the config or show it
+func requireAdminToken(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if AdminAPIToken == "" {
+			ReturnHTTPError(w, r, http.StatusForbidden, "The config admin API is disabled, start the proxy with --admin-api-token")
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get(AdminTokenHeader)), []byte(AdminAPIToken)) != 1 {
+			ReturnHTTPError(w, r, http.StatusUnauthorized, "Missing or wrong "+AdminTokenHeader)
+			return
+		}
+		handler(w, r)
+	}
+}
+
+//updateConfig runs a manager.UpdateConfig change and answers with what view picks from the updated config, secrets masked
+func updateConfig(w http.ResponseWriter, r *http.Request, status int, update func(configFields *manager.ConfigFileFields) error, view func(configFields manager.ConfigFileFields) interface{}) {
+	updatedConfigFields, err := manager.UpdateConfig(update)
+	if err != nil {
+		updateErr, ok := err.(*manager.ConfigUpdateError)
+		if !ok {
+			updateErr = &manager.ConfigUpdateError{Status: http.StatusInternalServerError, Message: err.Error()}
+		}
+		log.Debugf("Config update %v %v failed: %v", r.Method, r.URL.Path, err)
+		ReturnHTTPError(w, r, updateErr.Status, updateErr.Message)
+		return
+	}
+	if view == nil {
+		w.WriteHeader(status)
+		return
+	}
+	content, err := json.Marshal(view(manager.MaskedConfig(updatedConfigFields)))
+	if err != nil {
+		log.Errorf("Error marshalling the response of %v: %v", r.URL.Path, err)
+		ReturnHTTPError(w, r, http.StatusInternalServerError, "Failed to marshal the response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+}
+
+//readJSON decodes the request body into v, answering 400 when it can not
+func readJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	content, err := ioutil.ReadAll(r.Body)
+	if err == nil {
+		err = json.Unmarshal(content, v)
+	}
+	if err != nil {
+		ReturnHTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading json request body: %v", err))
+		return false
+	}
+	return true
+}
+
+//insertPosition reads the optional position query parameter, length when not set
+func insertPosition(w http.ResponseWriter, r *http.Request, length int) (int, bool) {
+	value := r.URL.Query().Get("position")
+	if value == "" {
+		return length, true
+	}
+	position, err := strconv.Atoi(value)
+	if err != nil || position < 0 || position > length {
+		ReturnHTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("position must be between 0 and %v", length))
+		return 0, false
+	}
+	return position, true
+}
+
+func findPrefilter(configFields manager.ConfigFileFields, id string) int {
+	for i, filter := range configFields.Prefilters {
+		if filter.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func findDestination(configFields manager.ConfigFileFields, id string) int {
+	for i, destination := range configFields.Destinations {
+		if destination.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func listPrefilters(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, manager.MaskedConfig(manager.LoadLiveConfig().Fields()).Prefilters)
+}
+
+func getPrefilter(w http.ResponseWriter, r *http.Request) {
+	configFields := manager.MaskedConfig(manager.LoadLiveConfig().Fields())
+	index := findPrefilter(configFields, mux.Vars(r)["id"])
+	if index < 0 {
+		ReturnHTTPError(w, r, http.StatusNotFound, fmt.Sprintf("No prefilter %v", mux.Vars(r)["id"]))
+		return
+	}
+	writeJSON(w, r, configFields.Prefilters[index])
+}
+
+func createPrefilter(w http.ResponseWriter, r *http.Request) {
+	filter := model.FilterData{}
+	if !readJSON(w, r, &filter) {
+		return
+	}
+	position, ok := insertPosition(w, r, len(manager.LoadLiveConfig().Fields().Prefilters))
+	if !ok {
+		return
+	}
+	updateConfig(w, r, http.StatusCreated, func(configFields *manager.ConfigFileFields) error {
+		if filter.ID != "" && findPrefilter(*configFields, filter.ID) >= 0 {
+			return fmt.Errorf("prefilter %v already exists", filter.ID)
+		}
+		if position > len(configFields.Prefilters) {
+			position = len(configFields.Prefilters)
+		}
+		prefilters := append([]model.FilterData{}, configFields.Prefilters[:position]...)
+		prefilters = append(prefilters, filter)
+		configFields.Prefilters = append(prefilters, configFields.Prefilters[position:]...)
+		return nil
+	}, func(configFields manager.ConfigFileFields) interface{} {
+		return configFields.Prefilters[position]
+	})
+}
+
+func updatePrefilter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	filter := model.FilterData{}
+	if !readJSON(w, r, &filter) {
+		return
+	}
+	updateConfig(w, r, http.StatusOK, func(configFields *manager.ConfigFileFields) error {
+		index := findPrefilter(*configFields, id)
+		if index < 0 {
+			return manager.NotFoundError("No prefilter %v", id)
+		}
+		filter.ID = id
+		filter.SecretToken = manager.KeepSecretToken(filter.SecretToken, configFields.Prefilters[index].SecretToken)
+		configFields.Prefilters[index] = filter
+		return nil
+	}, func(configFields manager.ConfigFileFields) interface{} {
+		return configFields.Prefilters[findPrefilter(configFields, id)]
+	})
+}
+
+func deletePrefilter(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	updateConfig(w, r, http.StatusNoContent, func(configFields *manager.ConfigFileFields) error {
+		index := findPrefilter(*configFields, id)
+		if index < 0 {
+			return manager.NotFoundError("No prefilter %v", id)
+		}
+		configFields.Prefilters = append(configFields.Prefilters[:index], configFields.Prefilters[index+1:]...)
+		return nil
+	}, nil)
+}
+
+func listDestinations(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, manager.LoadLiveConfig().Fields().Destinations)
+}
+
+func getDestination(w http.ResponseWriter, r *http.Request) {
+	configFields := manager.LoadLiveConfig().Fields()
+	index := findDestination(configFields, mux.Vars(r)["id"])
+	if index < 0 {
+		ReturnHTTPError(w, r, http.StatusNotFound, fmt.Sprintf("No destination %v", mux.Vars(r)["id"]))
+		return
+	}
+	writeJSON(w, r, configFields.Destinations[index])
+}
+
+func createDestination(w http.ResponseWriter, r *http.Request) {
+	destination := manager.Destination{}
+	if !readJSON(w, r, &destination) {
+		return
+	}
+	updateConfig(w, r, http.StatusCreated, func(configFields *manager.ConfigFileFields) error {
+		if destination.ID != "" && findDestination(*configFields, destination.ID) >= 0 {
+			return fmt.Errorf("destination %v already exists", destination.ID)
+		}
+		configFields.Destinations = append(configFields.Destinations, destination)
+		return nil
+	}, func(configFields manager.ConfigFileFields) interface{} {
+		//destinations are appended
+		return configFields.Destinations[len(configFields.Destinations)-1]
+	})
+}
+
+func updateDestination(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	destination := manager.Destination{}
+	if !readJSON(w, r, &destination) {
+		return
+	}
+	updateConfig(w, r, http.StatusOK, func(configFields *manager.ConfigFileFields) error {
+		index := findDestination(*configFields, id)
+		if index < 0 {
+			return manager.NotFoundError("No destination %v", id)
+		}
+		destination.ID = id
+		configFields.Destinations[index] = destination
+		return nil
+	}, func(configFields manager.ConfigFileFields) interface{} {
+		return configFields.Destinations[findDestination(configFields, id)]
+	})
+}
+
+func deleteDestination(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	updateConfig(w, r, http.StatusNoContent, func(configFields *manager.ConfigFileFields) error {
+		index := findDestination(*configFields, id)
+		if index < 0 {
+			return manager.NotFoundError("No destination %v", id)
+		}
+		configFields.Destinations = append(configFields.Destinations[:index], configFields.Destinations[index+1:]...)
+		return nil
+	}, nil)
+}
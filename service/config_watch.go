@@ -0,0 +1,62 @@
+package service
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//reloadRetryInterval is how often a SIGHUP reload is tried again while another reload runs
+const reloadRetryInterval = 100 * time.Millisecond
+
+//ReloadConfig reloads the config file, the previous config stays when the file is invalid
+func ReloadConfig() error {
+	return manager.Reload()
+}
+
+//WatchConfigFile reloads the config when the file, or the target of its symlinks, changes
+func WatchConfigFile(configFile string, interval time.Duration, debounce time.Duration) {
+	util.WatchFile(configFile, interval, debounce, func() bool {
+		//changes made through the admin API are already live
+		if !manager.ConfigFileChanged() {
+			return true
+		}
+		log.Infof("Config file %v changed, reloading", configFile)
+		err := ReloadConfig()
+		if err == manager.ErrReloadInProgress {
+			//the running reload may have read the file before the change, try again on the next poll
+			return false
+		}
+		if err != nil {
+			log.Errorf("Reload after a change of %v failed, keeping the previous config: %v", configFile, err)
+		}
+		return true
+	})
+	log.Infof("Watching %v for changes every %v", configFile, interval)
+}
+
+//ReloadOnSIGHUP reloads the config every time the process gets SIGHUP
+func ReloadOnSIGHUP() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	go func() {
+		for range signals {
+			log.Info("SIGHUP received, reloading the config")
+			err := ReloadConfig()
+			//the running reload may have read the file before the signal, wait for it and reload again
+			for err == manager.ErrReloadInProgress {
+				time.Sleep(reloadRetryInterval)
+				err = ReloadConfig()
+			}
+			if err != nil {
+				log.Errorf("Reload on SIGHUP failed, keeping the previous config: %v", err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//maxRequestIDLength bounds the request IDs accepted from clients
+const maxRequestIDLength = 128
+
+//ensureRequestID keeps the X-Request-Id of the client, or sets a new one, and returns it to the client
+func ensureRequestID(w http.ResponseWriter, r *http.Request) string {
+	requestID := r.Header.Get(model.RequestIDHeader)
+	if !validRequestID(requestID) {
+		requestID = util.GenerateUUID()
+	}
+	r.Header.Set(model.RequestIDHeader, requestID)
+	w.Header().Set(model.RequestIDHeader, requestID)
+	return requestID
+}
+
+//validRequestID accepts IDs safe to log and to send back in a header
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+//removeRequestID drops the request ID set by the destination, the client already has the proxy one
+func removeRequestID(resp *http.Response) error {
+	resp.Header.Del(model.RequestIDHeader)
+	return nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/tracing"
+)
+
+var (
+	requestDuration = metrics.NewHistogramVec(
+		"api_filter_proxy_request_duration_seconds",
+		"Time to serve a request, filters and destination included",
+		metrics.DefaultBuckets,
+		"route", "method", "destination", "status",
+	)
+
+	requestsInFlight = metrics.NewGaugeVec(
+		"api_filter_proxy_requests_in_flight",
+		"Requests being served",
+	)
+
+	destinationDuration = metrics.NewHistogramVec(
+		"api_filter_proxy_destination_duration_seconds",
+		"Time until the destination answered with its response headers",
+		metrics.DefaultBuckets,
+		"destination", "status",
+	)
+)
+
+type requestInfoKey struct{}
+
+//requestInfo is filled by the handlers with what the metrics are labeled by
+type requestInfo struct {
+	route       string
+	destination string
+	//destinationLabel is the destination in the metrics, see manager.DestinationLabel
+	destinationLabel string
+	//filterTime is the time spent running the prefilters
+	filterTime time.Duration
+}
+
+func getRequestInfo(r *http.Request) *requestInfo {
+	if info, ok := r.Context().Value(requestInfoKey{}).(*requestInfo); ok {
+		return info
+	}
+	//requests served outside of MuxWrapper
+	return &requestInfo{}
+}
+
+//setDestination records where the request was proxied to
+func setDestination(r *http.Request, destination manager.Destination) {
+	info := getRequestInfo(r)
+	info.destination = destination.DestinationURL
+	info.destinationLabel = manager.DestinationLabel(destination)
+}
+
+//routeHandler labels the requests served by handler with route, the route template
+func routeHandler(route string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		getRequestInfo(r).route = route
+		handler(w, r)
+	}
+}
+
+//instrument serves the request with handler in a span continuing the caller trace, and records its metrics and access log
+func instrument(handler http.Handler, w http.ResponseWriter, r *http.Request) {
+	requestsInFlight.Inc()
+	defer requestsInFlight.Dec()
+
+	start := time.Now()
+	parent, _ := tracing.Extract(r.Header)
+	span := tracing.StartSpan("HTTP "+r.Method, tracing.KindServer, parent)
+	defer span.Finish()
+
+	info := &requestInfo{}
+	ctx := tracing.NewContext(context.WithValue(r.Context(), requestInfoKey{}, info), span)
+	recorder := &statusRecorder{ResponseWriter: w}
+	handler.ServeHTTP(recorder, r.WithContext(ctx))
+
+	destination := info.destinationLabel
+	if destination == "" {
+		destination = "none"
+	}
+	//requests answered by the router itself, like the redirects of unclean paths, matched no route
+	if info.route == "" {
+		info.route = "{none}"
+	}
+	latency := time.Since(start)
+	writeAccessLog(r, info, recorder, start, latency)
+	status := recorder.Status()
+	requestDuration.Observe(latency.Seconds(), info.route, r.Method, destination, strconv.Itoa(status))
+
+	span.Name = "HTTP " + r.Method + " " + info.route
+	span.SetAttribute("http.method", r.Method)
+	span.SetAttribute("http.route", info.route)
+	span.SetAttribute("http.target", r.URL.Path)
+	span.SetAttribute("http.status_code", strconv.Itoa(status))
+	span.SetAttribute("proxy.destination", info.destination)
+	if status >= 500 {
+		span.SetError(http.StatusText(status))
+	}
+}
+
+//timedTransport records the destination round trips in the metrics and in a child span of the request,
+//labeled with the destination set by setDestination
+type timedTransport struct {
+	http.RoundTripper
+}
+
+func (t *timedTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	destination := getRequestInfo(req).destinationLabel
+	if destination == "" {
+		destination = "none"
+	}
+	span := tracing.StartChildSpan(req.Context(), "destination "+destination, tracing.KindClient)
+	defer span.Finish()
+	//a RoundTripper must not change the request it is given
+	req = req.Clone(req.Context())
+	span.Inject(req.Header)
+
+	start := time.Now()
+	resp, err := t.RoundTripper.RoundTrip(req)
+	status := "error"
+	if err == nil {
+		status = strconv.Itoa(resp.StatusCode)
+	} else {
+		span.SetError(err.Error())
+	}
+	destinationDuration.Observe(time.Since(start).Seconds(), destination, status)
+	span.SetAttribute("http.url", req.URL.String())
+	span.SetAttribute("http.status_code", status)
+	return resp, err
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//maxCapturedBody is the largest destination response body passed on to notifiers
+const maxCapturedBody = 1 << 20
+
+//responseCapture records the destination response for the notifiers
+type responseCapture struct {
+	captureBody bool
+	status      int
+	body        interface{}
+}
+
+//modifyResponse is used as httputil.ReverseProxy.ModifyResponse
+func (c *responseCapture) modifyResponse(resp *http.Response) error {
+	removeRequestID(resp)
+	c.status = resp.StatusCode
+	if !c.captureBody || resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxCapturedBody+1))
+	//the client still gets the whole body, read or not
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(content), resp.Body), resp.Body}
+	if err != nil || len(content) > maxCapturedBody {
+		return nil
+	}
+
+	//the client gets the body as the destination encoded it, notifiers get it decoded
+	switch strings.ToLower(resp.Header.Get("Content-Encoding")) {
+	case "", "identity":
+	case "gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil
+		}
+		content, err = ioutil.ReadAll(io.LimitReader(reader, maxCapturedBody+1))
+		if err != nil || len(content) > maxCapturedBody {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	var body interface{}
+	if err := json.Unmarshal(content, &body); err != nil {
+		body = string(content)
+	}
+	c.body = body
+	return nil
+}
+
+//statusRecorder remembers the status and the number of body bytes written to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+//Flush keeps the reverse proxy FlushInterval working through the recorder
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+//Hijack lets the reverse proxy switch protocols, for websockets, through the recorder
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("%T can not be hijacked", r.ResponseWriter)
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && r.status == 0 {
+		//the reverse proxy writes the 101 on the connection itself
+		r.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+//Unwrap gives http.ResponseController access to the writer underneath
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+//Status returns the status sent, 200 if the handler wrote nothing
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+//Bytes returns the number of body bytes sent
+func (r *statusRecorder) Bytes() int64 {
+	return r.bytes
+}
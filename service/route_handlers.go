@@ -11,10 +11,13 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/rancher/api-filter-proxy/manager"
 	"github.com/rancher/api-filter-proxy/model"
+	"github.com/rancher/api-filter-proxy/notifier"
+	"github.com/rancher/api-filter-proxy/util"
 )
 
 //ReturnHTTPError handles sending out CatalogError response
@@ -27,6 +30,9 @@ func ReturnHTTPError(w http.ResponseWriter, r *http.Request, httpStatus int, err
 }
 
 func writeError(w http.ResponseWriter, svcError model.ProxyError) {
+	if svcError.RequestID == "" {
+		svcError.RequestID = w.Header().Get(model.RequestIDHeader)
+	}
 	status, err := strconv.Atoi(svcError.Status)
 	if err != nil {
 		log.Errorf("Error writing error response %v", err)
@@ -51,95 +57,202 @@ type Proxy struct {
 	reverseProxy *httputil.ReverseProxy
 }
 
-func NewProxy(target string) (*Proxy, error) {
+func NewProxy(target string, tlsConfig *model.TLSConfig) (*Proxy, error) {
 	url, err := url.Parse(target)
 	if err != nil {
 		log.Errorf("Error reading destination URL %v", target)
 		return nil, err
 	}
+	transport, err := util.GetTransport(tlsConfig)
+	if err != nil {
+		log.Errorf("Error configuring TLS for destination URL %v: %v", target, err)
+		return nil, err
+	}
 	newProxy := httputil.NewSingleHostReverseProxy(url)
 	newProxy.FlushInterval = time.Millisecond * 100
+	newProxy.ModifyResponse = removeRequestID
+	newProxy.ErrorHandler = proxyError
+	newProxy.Transport = &timedTransport{RoundTripper: transport}
 	return &Proxy{target: url, reverseProxy: newProxy}, nil
 }
 
+//proxyError answers 502 when the destination can not be reached, logging the error with the request ID
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	logger := util.RequestLogger(r.Header.Get(model.RequestIDHeader))
+	logger.Errorf("Error proxying %v %v to the destination: %v", r.Method, r.URL.Path, err)
+	ReturnHTTPError(w, r, http.StatusBadGateway, "Error reaching the destination")
+}
+
 func handleRequest(w http.ResponseWriter, r *http.Request) {
 	path, _ := mux.CurrentRoute(r).GetPathTemplate()
+	logger := util.RequestLogger(r.Header.Get(model.RequestIDHeader))
 
-	log.Debugf("Request Path matched: %v", path)
+	logger.Debugf("Request Path matched: %v", path)
 
 	bodyBytes, err := ioutil.ReadAll(r.Body)
 	if err != nil {
-		log.Errorf("Error reading request Body %v for path %v", r, path)
+		logger.Errorf("Error reading request Body for path %v: %v", path, err)
 		ReturnHTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading json request body, err: %v", err))
 		return
 	}
 
-	var jsonInput map[string]interface{}
-	if len(bodyBytes) > 0 {
-		err = json.Unmarshal(bodyBytes, &jsonInput)
-		if err != nil {
-			log.Errorf("Error unmarshalling json request body: %v", err)
-			ReturnHTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("Error reading json request body: %v", err))
-			return
-		}
-	}
-
 	headerMap := make(map[string][]string)
 	for key, value := range r.Header {
 		headerMap[key] = value
 	}
 
-	api := r.URL.Path
+	filterStart := time.Now()
+	requestData, destination, notifiers, proxyErr := manager.ProcessPreFilters(path, r, bodyBytes, headerMap)
+	getRequestInfo(r).filterTime = time.Since(filterStart)
+
+	recorder := &statusRecorder{ResponseWriter: w}
+	w = recorder
+	defer func() {
+		manager.ObserveResponse(requestData, recorder.Status())
+	}()
 
-	inputBody, inputHeaders, destination, proxyErr := manager.ProcessPreFilters(path, api, jsonInput, headerMap)
 	if proxyErr.Status != "" {
 		//error from some filter
-		log.Debugf("Error from proxy filter %v", proxyErr)
+		logger.Debugf("Error from proxy filter %v", proxyErr)
 		writeError(w, proxyErr)
 		return
 	}
 
-	jsonStr, err := json.Marshal(inputBody)
-	destReq, err := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(jsonStr))
+	//the body is only rewritten when prefilters parsed it
+	if requestData.Body != nil {
+		bodyBytes, err = json.Marshal(requestData.Body)
+		if err != nil {
+			logger.Errorf("Error marshalling the filtered request body for path %v: %v", r.URL.String(), err)
+			ReturnHTTPError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error marshalling the filtered request body for path %v", r.URL.String()))
+			return
+		}
+	}
+	destReq, err := http.NewRequest(r.Method, r.URL.String(), bytes.NewReader(bodyBytes))
 	if err != nil {
-		log.Errorf("Error creating new request for path %v, error: %v, body: %v", r.URL.String(), err, jsonStr)
+		logger.Errorf("Error creating new request for path %v, error: %v, body: %s", r.URL.String(), err, util.RedactJSON(bodyBytes))
 		ReturnHTTPError(w, r, http.StatusBadRequest, fmt.Sprintf("Error creating new request for path %v to send to destination", r.URL.String()))
 		return
 	}
-	for key, value := range inputHeaders {
+	//the request span and cancellation follow the request to the destination
+	destReq = destReq.WithContext(r.Context())
+	for key, value := range requestData.Headers {
 		for _, singleVal := range value {
 			destReq.Header.Add(key, singleVal)
 		}
 	}
+	//filters may drop headers, the request ID always goes on
+	destReq.Header.Set(model.RequestIDHeader, requestData.UUID)
 
-	destProxy, err := NewProxy(destination)
+	destProxy, err := NewProxy(destination.DestinationURL, destination.TLS)
 	if err != nil {
-		log.Errorf("Error creating a reverse proxy for destination %v", destination)
-		ReturnHTTPError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating a reverse proxy for destination %v", destination))
+		logger.Errorf("Error creating a reverse proxy for destination %v", destination.DestinationURL)
+		ReturnHTTPError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating a reverse proxy for destination %v", destination.DestinationURL))
+		return
+	}
+
+	setDestination(r, destination)
+
+	if len(notifiers) == 0 {
+		destProxy.reverseProxy.ServeHTTP(w, destReq)
 		return
 	}
+
+	capture := &responseCapture{}
+	for _, notifierData := range notifiers {
+		capture.captureBody = capture.captureBody || notifierData.IncludeResponseBody
+	}
+	destProxy.reverseProxy.ModifyResponse = capture.modifyResponse
 	destProxy.reverseProxy.ServeHTTP(w, destReq)
+
+	if capture.status < 200 || capture.status >= 300 {
+		return
+	}
+	//notifiers get the request metadata only
+	metadata := requestData
+	metadata.Headers = nil
+	metadata.Body = nil
+	metadata.Decisions = util.RedactDecisions(metadata.Decisions)
+	for _, notifierData := range notifiers {
+		notification := model.NotificationData{Request: metadata, Status: capture.status}
+		if notifierData.IncludeResponseBody {
+			notification.ResponseBody = capture.body
+		}
+		notifier.Enqueue(notifierData, notification)
+	}
 }
 
 func handleNotFoundRequest(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("Request path NOT matched to proxy config: %v, proxy to %v", r.URL.Path, manager.DefaultDestination)
-	destProxy, err := NewProxy(manager.DefaultDestination)
+	logger := util.RequestLogger(r.Header.Get(model.RequestIDHeader))
+	logger.Debugf("Request path NOT matched to proxy config: %v, proxy to %v", r.URL.Path, manager.DefaultDestination)
+	destProxy, err := NewProxy(manager.DefaultDestination, nil)
 	if err != nil {
-		log.Errorf("Error creating a reverse proxy for destination %v", manager.DefaultDestination)
+		logger.Errorf("Error creating a reverse proxy for destination %v", manager.DefaultDestination)
 		ReturnHTTPError(w, r, http.StatusInternalServerError, fmt.Sprintf("Error creating a reverse proxy for destination %v", manager.DefaultDestination))
 		return
 	}
+	setDestination(r, manager.Destination{DestinationURL: manager.DefaultDestination})
 	destProxy.reverseProxy.ServeHTTP(w, r)
 }
 
 func reload(w http.ResponseWriter, r *http.Request) {
 	log.Info("Reload proxy config")
-	err := manager.Reload()
+	err := ReloadConfig()
+	if err == manager.ErrReloadInProgress {
+		ReturnHTTPError(w, r, http.StatusConflict, "A config reload or update is already in progress, try again")
+		return
+	}
 	if err != nil {
 		//failed to reload the config from the config.json
 		log.Debugf("Reload failed with error %v", err)
 		ReturnHTTPError(w, r, http.StatusInternalServerError, "Failed to reload the proxy config")
 		return
 	}
-	Wrapper.Router = NewRouter(manager.ConfigFields)
+}
+
+func notificationStats(w http.ResponseWriter, r *http.Request) {
+	stats := notifier.GetStats()
+	jsonStr, err := json.Marshal(stats)
+	if err != nil {
+		log.Errorf("Error marshalling the notifier queue stats: %v", err)
+		ReturnHTTPError(w, r, http.StatusInternalServerError, "Failed to read the notifier queue stats")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(jsonStr)
+}
+
+func healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(`{"status":"ok"}`))
+}
+
+func readyz(w http.ResponseWriter, r *http.Request) {
+	ready, checks := manager.CheckReadiness()
+	jsonStr, err := json.Marshal(struct {
+		Ready  bool                     `json:"ready"`
+		Checks []manager.ReadinessCheck `json:"checks"`
+	}{ready, checks})
+	if err != nil {
+		log.Errorf("Error marshalling the readiness checks: %v", err)
+		ReturnHTTPError(w, r, http.StatusInternalServerError, "Failed to check readiness")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(jsonStr)
+}
+
+//methodNotAllowed answers 405 with the methods of the admin endpoint in the Allow header
+func methodNotAllowed(methods []string) http.HandlerFunc {
+	allow := strings.Join(methods, ", ")
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Allow", allow)
+		ReturnHTTPError(w, r, http.StatusMethodNotAllowed, fmt.Sprintf("Method %v not allowed on %v, use %v", r.Method, r.URL.Path, allow))
+	}
+}
+
+func handleUnknownAdminRequest(w http.ResponseWriter, r *http.Request) {
+	ReturnHTTPError(w, r, http.StatusNotFound, fmt.Sprintf("No proxy admin endpoint %v %v", r.Method, r.URL.Path))
 }
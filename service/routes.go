@@ -5,19 +5,122 @@ import (
 	"github.com/gorilla/mux"
 	"net/http"
 	"strings"
+	"sync"
 
 	"github.com/rancher/api-filter-proxy/manager"
+	"github.com/rancher/api-filter-proxy/metrics"
+	"github.com/rancher/api-filter-proxy/model"
 )
 
 var Wrapper *MuxWrapper
 
-//MuxWrapper is a wrapper over the mux router
+//NewMuxWrapper returns a wrapper serving the live config, its router is rebuilt with every config made live
+func NewMuxWrapper() *MuxWrapper {
+	wrapper := &MuxWrapper{Router: NewRouter(manager.LoadLiveConfig().Fields())}
+	manager.OnConfigApplied = func(configFields manager.ConfigFileFields) {
+		wrapper.SetRouter(NewRouter(configFields))
+	}
+	return wrapper
+}
+
+//MuxWrapper is a wrapper over the mux router, which can be swapped while serving
 type MuxWrapper struct {
 	Router *mux.Router
+	mu     sync.RWMutex
 }
 
 func (httpWrapper *MuxWrapper) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	httpWrapper.Router.ServeHTTP(w, r)
+	ensureRequestID(w, r)
+	//only the proxy sets the original caller, whatever route the request takes
+	r.Header.Del(model.OriginalCallerHeader)
+	instrument(httpWrapper.router(), w, r)
+}
+
+//SetRouter serves the next requests with router
+func (httpWrapper *MuxWrapper) SetRouter(router *mux.Router) {
+	httpWrapper.mu.Lock()
+	defer httpWrapper.mu.Unlock()
+	httpWrapper.Router = router
+}
+
+func (httpWrapper *MuxWrapper) router() *mux.Router {
+	httpWrapper.mu.RLock()
+	defer httpWrapper.mu.RUnlock()
+	return httpWrapper.Router
+}
+
+//Route names tell the admin API how a request would be handled
+const (
+	adminRouteName    = "admin"
+	pathRouteName     = "path"
+	resourceRouteName = "resource"
+)
+
+type adminRoute struct {
+	method  string
+	path    string
+	handler http.HandlerFunc
+}
+
+//adminRoutes lists the proxy own endpoints
+func adminRoutes() []adminRoute {
+	return []adminRoute{
+		{"POST", "/v1-api-filter-proxy/reload", reload},
+		{"GET", "/v1-api-filter-proxy/notifications", requireAdminToken(notificationStats)},
+		{"GET", "/v1-api-filter-proxy/healthz", healthz},
+		{"GET", "/v1-api-filter-proxy/readyz", readyz},
+		{"GET", "/v1-api-filter-proxy/config", requireAdminToken(showConfig)},
+		{"GET", "/v1-api-filter-proxy/routes", requireAdminToken(showRoutes)},
+		{"GET", "/v1-api-filter-proxy/explain", requireAdminToken(explain)},
+		{"GET", "/v1-api-filter-proxy/prefilters", requireAdminToken(listPrefilters)},
+		{"POST", "/v1-api-filter-proxy/prefilters", requireAdminToken(createPrefilter)},
+		{"GET", "/v1-api-filter-proxy/prefilters/{id}", requireAdminToken(getPrefilter)},
+		{"PUT", "/v1-api-filter-proxy/prefilters/{id}", requireAdminToken(updatePrefilter)},
+		{"DELETE", "/v1-api-filter-proxy/prefilters/{id}", requireAdminToken(deletePrefilter)},
+		{"GET", "/v1-api-filter-proxy/destinations", requireAdminToken(listDestinations)},
+		{"POST", "/v1-api-filter-proxy/destinations", requireAdminToken(createDestination)},
+		{"GET", "/v1-api-filter-proxy/destinations/{id}", requireAdminToken(getDestination)},
+		{"PUT", "/v1-api-filter-proxy/destinations/{id}", requireAdminToken(updateDestination)},
+		{"DELETE", "/v1-api-filter-proxy/destinations/{id}", requireAdminToken(deleteDestination)},
+		{"GET", "/metrics", metrics.Handler},
+	}
+}
+
+//proxyRoute is a method and path template sent through the prefilters
+type proxyRoute struct {
+	method string
+	path   string
+}
+
+//requestSelectors returns the selectors of the prefilters and notifiers, both need the requests they
+//select to go through handleRequest
+func requestSelectors(configFields manager.ConfigFileFields) []model.RequestSelector {
+	var selectors []model.RequestSelector
+	for _, filter := range configFields.Prefilters {
+		selectors = append(selectors, filter.RequestSelector)
+	}
+	for _, notifier := range configFields.Notifiers {
+		selectors = append(selectors, notifier.RequestSelector)
+	}
+	return selectors
+}
+
+//proxyRoutes returns the method and path routes of the selectors, in registration order without duplicates
+func proxyRoutes(selectors []model.RequestSelector) []proxyRoute {
+	var routes []proxyRoute
+	seen := make(map[proxyRoute]bool)
+	for _, selector := range selectors {
+		for _, path := range selector.Paths {
+			for _, method := range selector.Methods {
+				route := proxyRoute{method: strings.ToUpper(method), path: path}
+				if !seen[route] {
+					seen[route] = true
+					routes = append(routes, route)
+				}
+			}
+		}
+	}
+	return routes
 }
 
 //NewRouter creates and configures a mux router
@@ -25,17 +128,42 @@ func NewRouter(configFields manager.ConfigFileFields) *mux.Router {
 	// API framework routes
 	router := mux.NewRouter().StrictSlash(false)
 
-	for _, filter := range configFields.Prefilters {
-		//build router paths
-		for _, path := range filter.Paths {
-			for _, method := range filter.Methods {
-				log.Debugf("Adding route: %v %v", strings.ToUpper(method), path)
-				router.Methods(strings.ToUpper(method)).Path(path).HandlerFunc(http.HandlerFunc(handleRequest))
-			}
+	//proxy admin routes go first so no filter path or resource selector can shadow them
+	var adminPaths []string
+	allowedMethods := make(map[string][]string)
+	for _, route := range adminRoutes() {
+		router.Methods(route.method).Path(route.path).Name(adminRouteName).HandlerFunc(routeHandler(route.path, route.handler))
+		if allowedMethods[route.path] == nil {
+			adminPaths = append(adminPaths, route.path)
 		}
+		allowedMethods[route.path] = append(allowedMethods[route.path], route.method)
+	}
+	//known admin paths asked with another method
+	for _, path := range adminPaths {
+		router.Path(path).Name(adminRouteName).HandlerFunc(routeHandler(path, methodNotAllowed(allowedMethods[path])))
+	}
+	//the admin prefix belongs to the proxy, nothing under it goes to a destination
+	router.PathPrefix("/v1-api-filter-proxy/").Name(adminRouteName).HandlerFunc(routeHandler("/v1-api-filter-proxy/", handleUnknownAdminRequest))
+
+	selectors := requestSelectors(configFields)
+	//build router paths
+	for _, route := range proxyRoutes(selectors) {
+		log.Debugf("Adding route: %v %v", route.method, route.path)
+		router.Methods(route.method).Path(route.path).Name(pathRouteName).HandlerFunc(routeHandler(route.path, handleRequest))
 	}
-	router.Methods("POST").Path("/v1-api-filter-proxy/reload").HandlerFunc(http.HandlerFunc(reload))
-	router.NotFoundHandler = http.HandlerFunc(handleNotFoundRequest)
+
+	//requests not matched by a path may still be selected by resource
+	router.MatcherFunc(func(r *http.Request, rm *mux.RouteMatch) bool {
+		resource := manager.ParseResource(r.URL.Path, r.URL.Query())
+		for _, selector := range selectors {
+			if manager.MatchesResource(selector, r.Method, resource) {
+				return true
+			}
+		}
+		return false
+	}).Name(resourceRouteName).HandlerFunc(routeHandler("{resource}", handleRequest))
+
+	router.NotFoundHandler = routeHandler("{unmatched}", handleNotFoundRequest)
 
 	return router
 
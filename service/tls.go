@@ -0,0 +1,55 @@
+package service
+
+import (
+	"crypto/tls"
+
+	"github.com/rancher/api-filter-proxy/util"
+)
+
+//TLSOptions holds the listener TLS settings passed on the command line
+type TLSOptions struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	MinVersion   string
+	CipherSuites []string
+}
+
+//NewServerTLSConfig builds the listener tls.Config, certificates and client CA are reloaded from disk when rotated
+func NewServerTLSConfig(opts TLSOptions) (*tls.Config, error) {
+	minVersion, err := util.ParseTLSVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	cipherSuites, err := util.ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	certReloader, err := util.NewCertReloader(opts.CertFile, opts.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   cipherSuites,
+		GetCertificate: certReloader.GetCertificate,
+	}
+
+	if opts.ClientCAFile != "" {
+		caReloader, err := util.NewCertPoolReloader(opts.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+		//hand out a fresh config per handshake so a rotated CA bundle is picked up
+		tlsConfig.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			clientConfig := tlsConfig.Clone()
+			clientConfig.GetConfigForClient = nil
+			clientConfig.ClientCAs = caReloader.Pool()
+			return clientConfig, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
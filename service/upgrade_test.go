@@ -0,0 +1,98 @@
+package service
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rancher/api-filter-proxy/manager"
+)
+
+//newUpgradeBackend answers upgrade requests with 101 then echoes what it reads
+func newUpgradeBackend(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "websocket" {
+			t.Errorf("backend got Upgrade %q", r.Header.Get("Upgrade"))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("backend hijack: %v", err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		io.Copy(conn, rw)
+	}))
+}
+
+//upgrade sends an upgrade request to address and checks the echo of the switched connection
+func upgrade(t *testing.T, address string, path string) {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	fmt.Fprintf(conn, "GET %v HTTP/1.1\r\nHost: %v\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n", path, address)
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("got %v, want 101", resp.Status)
+	}
+	fmt.Fprint(conn, "ping\n")
+	line, err := reader.ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Errorf("got %q, %v through the switched connection, want the echo", line, err)
+	}
+}
+
+func TestUnmatchedRequestUpgrades(t *testing.T) {
+	backend := newUpgradeBackend(t)
+	defer backend.Close()
+
+	previous := manager.DefaultDestination
+	defer func() { manager.DefaultDestination = previous }()
+	manager.DefaultDestination = backend.URL
+
+	proxy := httptest.NewServer(&MuxWrapper{Router: NewRouter(manager.ConfigFileFields{})})
+	defer proxy.Close()
+	upgrade(t, proxy.Listener.Addr().String(), "/v2-beta/subscribe")
+}
+
+func TestRecorderUpgrades(t *testing.T) {
+	backend := newUpgradeBackend(t)
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+
+	//handleRequest records the status in a recorder of its own, inside the one of instrument
+	recorded := make(chan int, 1)
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: &statusRecorder{ResponseWriter: w}}
+		destProxy, err := NewProxy(target.String(), nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		destProxy.reverseProxy.ServeHTTP(recorder, r)
+		recorded <- recorder.Status()
+	}))
+	defer proxy.Close()
+
+	upgrade(t, proxy.Listener.Addr().String(), "/v2-beta/projects/1a5/containers/1i1?action=execute")
+	if status := <-recorded; status != http.StatusSwitchingProtocols {
+		t.Errorf("recorded status %v, want 101", status)
+	}
+}
@@ -0,0 +1,252 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	exportQueueSize = 2048
+	exportBatchSize = 256
+	exportInterval  = 5 * time.Second
+)
+
+//Options configures the span exporter
+type Options struct {
+	//Endpoint is the OTLP/HTTP traces URL, like http://collector:4318/v1/traces, spans are dropped when empty
+	Endpoint    string
+	ServiceName string
+	Timeout     time.Duration
+}
+
+type exporter struct {
+	opts   Options
+	spans  chan *Span
+	client *http.Client
+	//flush asks the exporter to send the spans it holds, the channel sent is closed once done
+	flush chan chan struct{}
+}
+
+var defaultExporter *exporter
+
+//Start sends finished spans to the OTLP endpoint in the background
+func Start(opts Options) {
+	if opts.Endpoint == "" {
+		return
+	}
+	if opts.ServiceName == "" {
+		opts.ServiceName = "api-filter-proxy"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	defaultExporter = newExporter(opts)
+	go defaultExporter.run()
+	log.Infof("Exporting traces to %v", opts.Endpoint)
+}
+
+//Shutdown sends the spans not exported yet, waiting at most timeout
+func Shutdown(timeout time.Duration) {
+	if defaultExporter != nil {
+		defaultExporter.shutdown(timeout)
+	}
+}
+
+func newExporter(opts Options) *exporter {
+	return &exporter{
+		opts:   opts,
+		spans:  make(chan *Span, exportQueueSize),
+		client: &http.Client{Timeout: opts.Timeout},
+		flush:  make(chan chan struct{}),
+	}
+}
+
+func export(span *Span) {
+	if defaultExporter != nil {
+		defaultExporter.export(span)
+	}
+}
+
+func (e *exporter) export(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		//tracing must never slow requests down
+		log.Debugf("Trace export queue full, dropping span %v", span.Name)
+	}
+}
+
+func (e *exporter) run() {
+	ticker := time.NewTicker(exportInterval)
+	defer ticker.Stop()
+	var batch []*Span
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) < exportBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		case done := <-e.flush:
+			e.sendAll(append(batch, e.queued()...))
+			batch = nil
+			close(done)
+			continue
+		}
+		e.sendAll(batch)
+		batch = nil
+	}
+}
+
+//queued takes the spans waiting in the queue
+func (e *exporter) queued() []*Span {
+	var spans []*Span
+	for {
+		select {
+		case span := <-e.spans:
+			spans = append(spans, span)
+		default:
+			return spans
+		}
+	}
+}
+
+//sendAll exports spans in batches of at most exportBatchSize
+func (e *exporter) sendAll(spans []*Span) {
+	for len(spans) > 0 {
+		batch := spans
+		if len(batch) > exportBatchSize {
+			batch = batch[:exportBatchSize]
+		}
+		spans = spans[len(batch):]
+		if err := e.send(batch); err != nil {
+			log.Warnf("Error exporting %v spans to %v: %v", len(batch), e.opts.Endpoint, err)
+		}
+	}
+}
+
+func (e *exporter) shutdown(timeout time.Duration) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	done := make(chan struct{})
+	select {
+	case e.flush <- done:
+	case <-timer.C:
+		log.Warnf("Timed out flushing spans to %v", e.opts.Endpoint)
+		return
+	}
+	select {
+	case <-done:
+	case <-timer.C:
+		log.Warnf("Timed out flushing spans to %v", e.opts.Endpoint)
+	}
+}
+
+func (e *exporter) send(batch []*Span) error {
+	body, err := json.Marshal(e.encode(batch))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.opts.Endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("collector answered %v", resp.Status)
+	}
+	return nil
+}
+
+//OTLP JSON encoding of ExportTraceServiceRequest
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue string `json:"stringValue"`
+}
+
+type otlpStatus struct {
+	//Code is 0 unset or 2 error
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+func (e *exporter) encode(batch []*Span) otlpRequest {
+	scopeSpans := otlpScopeSpans{Scope: otlpScope{Name: e.opts.ServiceName}}
+	for _, span := range batch {
+		span.mu.Lock()
+		encoded := otlpSpan{
+			TraceID:           span.Context.TraceID,
+			SpanID:            span.Context.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+		}
+		for key, value := range span.attributes {
+			encoded.Attributes = append(encoded.Attributes, otlpAttribute{Key: key, Value: otlpValue{StringValue: value}})
+		}
+		if span.err != "" {
+			encoded.Status = otlpStatus{Code: 2, Message: span.err}
+		}
+		span.mu.Unlock()
+		scopeSpans.Spans = append(scopeSpans.Spans, encoded)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: []otlpAttribute{
+			{Key: "service.name", Value: otlpValue{StringValue: e.opts.ServiceName}},
+		}},
+		ScopeSpans: []otlpScopeSpans{scopeSpans},
+	}}}
+}
@@ -0,0 +1,115 @@
+package tracing
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+//testCollector keeps the OTLP requests it receives
+type testCollector struct {
+	server *httptest.Server
+
+	mu       sync.Mutex
+	requests []otlpRequest
+}
+
+func newTestCollector(t *testing.T) *testCollector {
+	c := &testCollector{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("got content type %q", r.Header.Get("Content-Type"))
+		}
+		var request otlpRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid OTLP request: %v", err)
+		}
+		c.mu.Lock()
+		c.requests = append(c.requests, request)
+		c.mu.Unlock()
+	}))
+	return c
+}
+
+func (c *testCollector) spans() []otlpSpan {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var spans []otlpSpan
+	for _, request := range c.requests {
+		for _, resourceSpans := range request.ResourceSpans {
+			for _, scopeSpans := range resourceSpans.ScopeSpans {
+				spans = append(spans, scopeSpans.Spans...)
+			}
+		}
+	}
+	return spans
+}
+
+func TestExporterFlushesOnShutdown(t *testing.T) {
+	collector := newTestCollector(t)
+	defer collector.server.Close()
+
+	e := newExporter(Options{Endpoint: collector.server.URL, ServiceName: "test", Timeout: time.Second})
+	go e.run()
+
+	parent := StartSpan("HTTP POST", KindServer, SpanContext{})
+	child := StartSpan("filter http", KindClient, parent.Context)
+	child.SetAttribute("filter.decision", "deny")
+	child.SetError("denied")
+	child.End = time.Now()
+	e.export(child)
+	parent.End = time.Now()
+	e.export(parent)
+	//more than a batch, all sent well before the export interval
+	for i := 0; i < exportBatchSize; i++ {
+		span := StartSpan("extra", KindInternal, SpanContext{})
+		span.End = time.Now()
+		e.export(span)
+	}
+
+	e.shutdown(5 * time.Second)
+	spans := collector.spans()
+	if len(spans) != exportBatchSize+2 {
+		t.Fatalf("got %v spans, want %v", len(spans), exportBatchSize+2)
+	}
+	got := spans[0]
+	if got.TraceID != parent.Context.TraceID || got.SpanID != child.Context.SpanID || got.ParentSpanID != parent.Context.SpanID {
+		t.Errorf("got span %+v, want the child of %+v", got, parent.Context)
+	}
+	if got.Name != "filter http" || got.Kind != KindClient || got.Status.Code != 2 || got.Status.Message != "denied" {
+		t.Errorf("got span %+v", got)
+	}
+	if len(got.Attributes) != 1 || got.Attributes[0].Key != "filter.decision" || got.Attributes[0].Value.StringValue != "deny" {
+		t.Errorf("got attributes %+v", got.Attributes)
+	}
+	collector.mu.Lock()
+	resource := collector.requests[0].ResourceSpans[0].Resource
+	collector.mu.Unlock()
+	if len(resource.Attributes) != 1 || resource.Attributes[0].Value.StringValue != "test" {
+		t.Errorf("got resource %+v, want service.name test", resource)
+	}
+}
+
+func TestExporterShutdownTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer collector.Close()
+	defer close(release)
+
+	e := newExporter(Options{Endpoint: collector.URL, Timeout: 10 * time.Second})
+	go e.run()
+	span := StartSpan("HTTP GET", KindServer, SpanContext{})
+	span.End = time.Now()
+	e.export(span)
+
+	start := time.Now()
+	e.shutdown(100 * time.Millisecond)
+	if waited := time.Since(start); waited > 2*time.Second {
+		t.Errorf("shutdown waited %v for a stuck collector", waited)
+	}
+}
@@ -0,0 +1,207 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+//W3C trace-context headers
+const (
+	TraceParentHeader = "traceparent"
+	TraceStateHeader  = "tracestate"
+)
+
+//maxTraceState is the tracestate length passed on, longer ones keep their first entries
+const maxTraceState = 512
+
+//Span kinds as numbered by OTLP
+const (
+	KindInternal = 1
+	KindServer   = 2
+	KindClient   = 3
+)
+
+//SpanContext identifies a span across processes
+type SpanContext struct {
+	TraceID string
+	SpanID  string
+	Sampled bool
+	//TraceState is the vendor data of the caller, passed on as is
+	TraceState string
+}
+
+//IsValid reports if the context holds a trace and span ID
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != "" && c.SpanID != ""
+}
+
+//TraceParent formats the context as a traceparent header value
+func (c SpanContext) TraceParent() string {
+	flags := "00"
+	if c.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", c.TraceID, c.SpanID, flags)
+}
+
+//ParseTraceParent reads a traceparent header value, false if it is missing or invalid
+func ParseTraceParent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || (parts[0] == "00" && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	traceID, spanID, flags := strings.ToLower(parts[1]), strings.ToLower(parts[2]), parts[3]
+	if !isHex(traceID, 32) || !isHex(spanID, 16) || !isHex(flags, 2) {
+		return SpanContext{}, false
+	}
+	if traceID == strings.Repeat("0", 32) || spanID == strings.Repeat("0", 16) {
+		return SpanContext{}, false
+	}
+	flagBits, _ := hex.DecodeString(flags)
+	return SpanContext{TraceID: traceID, SpanID: spanID, Sampled: flagBits[0]&1 == 1}, true
+}
+
+//Extract reads the trace context of an incoming request, false if it has none or an invalid one. The
+//tracestate is only kept along with a valid traceparent.
+func Extract(header http.Header) (SpanContext, bool) {
+	spanContext, ok := ParseTraceParent(header.Get(TraceParentHeader))
+	if !ok {
+		return SpanContext{}, false
+	}
+	spanContext.TraceState = parseTraceState(header[http.CanonicalHeaderKey(TraceStateHeader)])
+	return spanContext, true
+}
+
+//parseTraceState joins the tracestate header values, dropping empty entries and the last ones past maxTraceState
+func parseTraceState(values []string) string {
+	var entries []string
+	length := 0
+	for _, value := range values {
+		for _, entry := range strings.Split(value, ",") {
+			entry = strings.TrimSpace(entry)
+			if entry == "" {
+				continue
+			}
+			if length+len(entry)+len(entries) > maxTraceState {
+				return strings.Join(entries, ",")
+			}
+			length += len(entry)
+			entries = append(entries, entry)
+		}
+	}
+	return strings.Join(entries, ",")
+}
+
+func isHex(value string, length int) bool {
+	if len(value) != length {
+		return false
+	}
+	_, err := hex.DecodeString(value)
+	return err == nil
+}
+
+func randomHex(bytes int) string {
+	id := make([]byte, bytes)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+//Span is a timed operation of a trace
+type Span struct {
+	Name         string
+	Kind         int
+	Context      SpanContext
+	ParentSpanID string
+	Start        time.Time
+	End          time.Time
+
+	mu         sync.Mutex
+	attributes map[string]string
+	err        string
+	ended      bool
+}
+
+//StartSpan starts a span, child of parent when valid, else the root of a new sampled trace
+func StartSpan(name string, kind int, parent SpanContext) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		Start:      time.Now(),
+		attributes: make(map[string]string),
+	}
+	if parent.IsValid() {
+		span.Context = SpanContext{TraceID: parent.TraceID, SpanID: randomHex(8), Sampled: parent.Sampled, TraceState: parent.TraceState}
+		span.ParentSpanID = parent.SpanID
+	} else {
+		span.Context = SpanContext{TraceID: randomHex(16), SpanID: randomHex(8), Sampled: true}
+	}
+	return span
+}
+
+//StartChildSpan starts a child of the span in ctx, or a new trace when there is none
+func StartChildSpan(ctx context.Context, name string, kind int) *Span {
+	var parent SpanContext
+	if span := FromContext(ctx); span != nil {
+		parent = span.Context
+	}
+	return StartSpan(name, kind, parent)
+}
+
+//SetAttribute adds a string attribute to the span
+func (s *Span) SetAttribute(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attributes[key] = value
+}
+
+//SetError marks the span as failed
+func (s *Span) SetError(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = message
+}
+
+//Finish ends the span and hands it to the exporter, later calls do nothing
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+	if s.Context.Sampled {
+		export(s)
+	}
+}
+
+//Inject sets the trace context headers of an outgoing request to the span
+func (s *Span) Inject(header http.Header) {
+	header.Set(TraceParentHeader, s.Context.TraceParent())
+	if s.Context.TraceState != "" {
+		header.Set(TraceStateHeader, s.Context.TraceState)
+	} else {
+		//a tracestate sent along an invalid traceparent belongs to no trace of ours
+		header.Del(TraceStateHeader)
+	}
+}
+
+type spanKey struct{}
+
+//NewContext returns ctx holding span
+func NewContext(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+//FromContext returns the span held by ctx, nil if none
+func FromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
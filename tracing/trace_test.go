@@ -0,0 +1,90 @@
+package tracing
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		value string
+		want  SpanContext
+		ok    bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}, true},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-00",
+			SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}, true},
+		//later versions may add fields
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+			SpanContext{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Sampled: true}, true},
+		{"", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", SpanContext{}, false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", SpanContext{}, false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902bz-01", SpanContext{}, false},
+	}
+	for _, test := range tests {
+		got, ok := ParseTraceParent(test.value)
+		if ok != test.ok || got != test.want {
+			t.Errorf("ParseTraceParent(%q) = %+v, %v, want %+v, %v", test.value, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestTraceParentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		span := StartSpan("test", KindServer, SpanContext{})
+		span.Context.Sampled = sampled
+		parsed, ok := ParseTraceParent(span.Context.TraceParent())
+		if !ok || parsed != span.Context {
+			t.Errorf("parsed %+v from %v, want %+v", parsed, span.Context.TraceParent(), span.Context)
+		}
+	}
+}
+
+func TestTraceStatePropagation(t *testing.T) {
+	incoming := http.Header{}
+	incoming.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	incoming.Add(TraceStateHeader, "congo=t61rcWkgMzE, ")
+	incoming.Add(TraceStateHeader, "rojo=00f067aa0ba902b7")
+	parent, ok := Extract(incoming)
+	if !ok {
+		t.Fatal("valid traceparent not extracted")
+	}
+	child := StartSpan("destination", KindClient, parent)
+	outgoing := http.Header{}
+	child.Inject(outgoing)
+	if got := outgoing.Get(TraceStateHeader); got != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+		t.Errorf("got tracestate %q", got)
+	}
+	if !strings.HasPrefix(outgoing.Get(TraceParentHeader), "00-4bf92f3577b34da6a3ce929d0e0e4736-") {
+		t.Errorf("got traceparent %q outside the caller trace", outgoing.Get(TraceParentHeader))
+	}
+
+	//without a valid traceparent the tracestate is dropped
+	incoming.Set(TraceParentHeader, "invalid")
+	if _, ok := Extract(incoming); ok {
+		t.Fatal("invalid traceparent extracted")
+	}
+	root := StartSpan("request", KindServer, SpanContext{})
+	root.Inject(incoming)
+	if got := incoming.Get(TraceStateHeader); got != "" {
+		t.Errorf("got tracestate %q for a new trace", got)
+	}
+}
+
+func TestTraceStateLimit(t *testing.T) {
+	entry := "vendor=" + strings.Repeat("a", 93)
+	var entries []string
+	for i := 0; i < 8; i++ {
+		entries = append(entries, entry)
+	}
+	got := parseTraceState([]string{strings.Join(entries, ",")})
+	if len(got) > maxTraceState || got != strings.Join(entries[:5], ",") {
+		t.Errorf("got tracestate of %v bytes, want the first 5 entries", len(got))
+	}
+}
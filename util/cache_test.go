@@ -0,0 +1,67 @@
+package util
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTTLCacheGetSet(t *testing.T) {
+	cache := NewTTLCache(time.Minute, 0)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("empty cache returned a value")
+	}
+	cache.Set("a", 1)
+	cache.Set("a", 2)
+	value, ok := cache.Get("a")
+	if !ok || value != 2 {
+		t.Fatalf("got %v %v, want 2 true", value, ok)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("got %v entries, want 1", cache.Len())
+	}
+}
+
+func TestTTLCacheExpiry(t *testing.T) {
+	cache := NewTTLCache(10*time.Millisecond, 0)
+	cache.Set("a", 1)
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := cache.Get("a"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if cache.Len() != 0 {
+		t.Fatalf("expired entry kept, %v entries", cache.Len())
+	}
+}
+
+func TestTTLCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewTTLCache(time.Minute, 2)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	//a becomes the most recently used, b is evicted next
+	cache.Get("a")
+	cache.Set("c", 3)
+
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"a", true},
+		{"b", false},
+		{"c", true},
+	}
+	for _, test := range tests {
+		if _, ok := cache.Get(test.key); ok != test.want {
+			t.Errorf("Get(%v) found %v, want %v", test.key, ok, test.want)
+		}
+	}
+}
+
+func TestTTLCachePurge(t *testing.T) {
+	cache := NewTTLCache(time.Minute, 0)
+	cache.Set("a", 1)
+	cache.Set("b", 2)
+	cache.Purge()
+	if _, ok := cache.Get("a"); ok || cache.Len() != 0 {
+		t.Fatalf("purged cache still has %v entries", cache.Len())
+	}
+}
@@ -0,0 +1,115 @@
+package util
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//DiffJSON returns the RFC 6902 operations turning a into b, objects are compared key by key
+func DiffJSON(a interface{}, b interface{}) []model.JSONPatchOperation {
+	return diffValues("", normalizeJSON(a), normalizeJSON(b))
+}
+
+func diffValues(pointer string, a interface{}, b interface{}) []model.JSONPatchOperation {
+	aObject, aIsObject := a.(map[string]interface{})
+	bObject, bIsObject := b.(map[string]interface{})
+	if !aIsObject || !bIsObject {
+		if reflect.DeepEqual(a, b) {
+			return nil
+		}
+		return []model.JSONPatchOperation{{Op: "replace", Path: pointer, Value: rawJSON(b)}}
+	}
+
+	var operations []model.JSONPatchOperation
+	for _, key := range sortedKeys(aObject) {
+		childPointer := pointer + "/" + escapePointerToken(key)
+		bValue, ok := bObject[key]
+		if !ok {
+			operations = append(operations, model.JSONPatchOperation{Op: "remove", Path: childPointer})
+			continue
+		}
+		operations = append(operations, diffValues(childPointer, aObject[key], bValue)...)
+	}
+	for _, key := range sortedKeys(bObject) {
+		if _, ok := aObject[key]; !ok {
+			operations = append(operations, model.JSONPatchOperation{Op: "add", Path: pointer + "/" + escapePointerToken(key), Value: rawJSON(bObject[key])})
+		}
+	}
+	return operations
+}
+
+//DiffHeaders returns the header operations turning a into b
+func DiffHeaders(a map[string][]string, b map[string][]string) []model.HeaderOperation {
+	aHeader, bHeader := canonicalHeader(a), canonicalHeader(b)
+	var operations []model.HeaderOperation
+	for _, name := range sortedHeaderNames(aHeader) {
+		if _, ok := bHeader[name]; !ok {
+			operations = append(operations, model.HeaderOperation{Op: "remove", Name: name})
+		}
+	}
+	for _, name := range sortedHeaderNames(bHeader) {
+		if reflect.DeepEqual(aHeader[name], bHeader[name]) {
+			continue
+		}
+		for i, value := range bHeader[name] {
+			op := "add"
+			if i == 0 {
+				op = "set"
+			}
+			operations = append(operations, model.HeaderOperation{Op: op, Name: name, Value: value})
+		}
+	}
+	return operations
+}
+
+func canonicalHeader(headers map[string][]string) http.Header {
+	header := http.Header{}
+	for key, value := range headers {
+		header[http.CanonicalHeaderKey(key)] = append(header[http.CanonicalHeaderKey(key)], value...)
+	}
+	return header
+}
+
+func sortedHeaderNames(header http.Header) []string {
+	var names []string
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func sortedKeys(object map[string]interface{}) []string {
+	var keys []string
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func escapePointerToken(token string) string {
+	return strings.Replace(strings.Replace(token, "~", "~0", -1), "/", "~1", -1)
+}
+
+//normalizeJSON turns typed values, like a nil map, into what json.Unmarshal would produce
+func normalizeJSON(value interface{}) interface{} {
+	normalized, err := deepCopy(value)
+	if err != nil {
+		return value
+	}
+	return normalized
+}
+
+func rawJSON(value interface{}) json.RawMessage {
+	content, err := json.Marshal(value)
+	if err != nil {
+		return json.RawMessage("null")
+	}
+	return content
+}
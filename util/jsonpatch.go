@@ -0,0 +1,297 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//ApplyJSONPatch applies RFC 6902 operations in order to a copy of doc, doc is left untouched on error
+func ApplyJSONPatch(doc interface{}, operations []model.JSONPatchOperation) (interface{}, error) {
+	doc, err := deepCopy(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, operation := range operations {
+		doc, err = applyOperation(doc, operation)
+		if err != nil {
+			return nil, fmt.Errorf("JSON patch operation %v (%v %v): %v", i, operation.Op, operation.Path, err)
+		}
+	}
+	return doc, nil
+}
+
+func applyOperation(doc interface{}, operation model.JSONPatchOperation) (interface{}, error) {
+	path, err := parseJSONPointer(operation.Path)
+	if err != nil {
+		return nil, err
+	}
+	switch operation.Op {
+	case "add", "replace", "test":
+		if operation.Value == nil {
+			return nil, fmt.Errorf("missing value")
+		}
+		var value interface{}
+		if err := json.Unmarshal(operation.Value, &value); err != nil {
+			return nil, fmt.Errorf("invalid value: %v", err)
+		}
+		switch operation.Op {
+		case "add":
+			return pointerAdd(doc, path, value)
+		case "replace":
+			if _, err := pointerGet(doc, path); err != nil {
+				return nil, err
+			}
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, err = pointerRemove(doc, path); err != nil {
+				return nil, err
+			}
+			return pointerAdd(doc, path, value)
+		default:
+			current, err := pointerGet(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !reflect.DeepEqual(current, value) {
+				return nil, fmt.Errorf("test failed")
+			}
+			return doc, nil
+		}
+	case "remove":
+		return pointerRemove(doc, path)
+	case "move", "copy":
+		from, err := parseJSONPointer(operation.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := pointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if operation.Op == "move" {
+			if strings.HasPrefix(operation.Path, operation.From+"/") {
+				return nil, fmt.Errorf("can not move a value into itself")
+			}
+			if doc, err = pointerRemove(doc, from); err != nil {
+				return nil, err
+			}
+		} else if value, err = deepCopy(value); err != nil {
+			return nil, err
+		}
+		return pointerAdd(doc, path, value)
+	}
+	return nil, fmt.Errorf("unknown op %v", operation.Op)
+}
+
+//parseJSONPointer splits a RFC 6901 pointer like /a/b~1c/0 into its unescaped tokens
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("JSON pointer %v must start with /", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+func arrayIndex(token string, length int, allowEnd bool) (int, error) {
+	if allowEnd && token == "-" {
+		return length, nil
+	}
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, fmt.Errorf("invalid array index %v", token)
+	}
+	if index > length || (!allowEnd && index == length) {
+		return 0, fmt.Errorf("array index %v out of bounds", token)
+	}
+	return index, nil
+}
+
+func pointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch value := doc.(type) {
+		case map[string]interface{}:
+			child, ok := value[token]
+			if !ok {
+				return nil, fmt.Errorf("path not found at %v", token)
+			}
+			doc = child
+		case []interface{}:
+			index, err := arrayIndex(token, len(value), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = value[index]
+		default:
+			return nil, fmt.Errorf("path not found at %v", token)
+		}
+	}
+	return doc, nil
+}
+
+//pointerAdd returns doc with value added at path, arrays are rebuilt so the parent is updated too
+func pointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	token := path[0]
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		if len(path) == 1 {
+			container[token] = value
+			return container, nil
+		}
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path not found at %v", token)
+		}
+		updated, err := pointerAdd(child, path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[token] = updated
+		return container, nil
+	case []interface{}:
+		if len(path) == 1 {
+			index, err := arrayIndex(token, len(container), true)
+			if err != nil {
+				return nil, err
+			}
+			updated := make([]interface{}, 0, len(container)+1)
+			updated = append(updated, container[:index]...)
+			updated = append(updated, value)
+			return append(updated, container[index:]...), nil
+		}
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := pointerAdd(container[index], path[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+	}
+	return nil, fmt.Errorf("path not found at %v", token)
+}
+
+func pointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("can not remove the whole document")
+	}
+	token := path[0]
+	switch container := doc.(type) {
+	case map[string]interface{}:
+		child, ok := container[token]
+		if !ok {
+			return nil, fmt.Errorf("path not found at %v", token)
+		}
+		if len(path) == 1 {
+			delete(container, token)
+			return container, nil
+		}
+		updated, err := pointerRemove(child, path[1:])
+		if err != nil {
+			return nil, err
+		}
+		container[token] = updated
+		return container, nil
+	case []interface{}:
+		index, err := arrayIndex(token, len(container), false)
+		if err != nil {
+			return nil, err
+		}
+		if len(path) == 1 {
+			updated := make([]interface{}, 0, len(container)-1)
+			updated = append(updated, container[:index]...)
+			return append(updated, container[index+1:]...), nil
+		}
+		updated, err := pointerRemove(container[index], path[1:])
+		if err != nil {
+			return nil, err
+		}
+		container[index] = updated
+		return container, nil
+	}
+	return nil, fmt.Errorf("path not found at %v", token)
+}
+
+//ApplyMergePatch applies a RFC 7386 merge patch to a copy of target
+func ApplyMergePatch(target interface{}, patch interface{}) (interface{}, error) {
+	target, err := deepCopy(target)
+	if err != nil {
+		return nil, err
+	}
+	return mergePatch(target, patch), nil
+}
+
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = make(map[string]interface{})
+	}
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+		} else {
+			targetObject[key] = mergePatch(targetObject[key], value)
+		}
+	}
+	return targetObject
+}
+
+//ApplyHeaderOperations applies add, set and remove operations in order to a copy of headers
+func ApplyHeaderOperations(headers map[string][]string, operations []model.HeaderOperation) (map[string][]string, error) {
+	header := http.Header{}
+	for key, value := range headers {
+		//filters may return non canonical header names
+		header[http.CanonicalHeaderKey(key)] = append(header[http.CanonicalHeaderKey(key)], value...)
+	}
+	for _, operation := range operations {
+		if operation.Name == "" {
+			return nil, fmt.Errorf("header operation %v without name", operation.Op)
+		}
+		switch operation.Op {
+		case "add":
+			header.Add(operation.Name, operation.Value)
+		case "set":
+			header.Set(operation.Name, operation.Value)
+		case "remove":
+			header.Del(operation.Name)
+		default:
+			return nil, fmt.Errorf("unknown header operation %v", operation.Op)
+		}
+	}
+	return header, nil
+}
+
+//deepCopy copies a decoded JSON document
+func deepCopy(doc interface{}) (interface{}, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	var copied interface{}
+	err = json.Unmarshal(content, &copied)
+	return copied, err
+}
@@ -0,0 +1,176 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func decodePatch(t *testing.T, content string) []model.JSONPatchOperation {
+	var operations []model.JSONPatchOperation
+	if err := json.Unmarshal([]byte(content), &operations); err != nil {
+		t.Fatalf("invalid test patch %v: %v", content, err)
+	}
+	return operations
+}
+
+func TestApplyJSONPatch(t *testing.T) {
+	doc := `{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"]}`
+	tests := []struct {
+		name  string
+		patch string
+		want  string
+	}{
+		{"add member", `[{"op": "add", "path": "/scale", "value": 2}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"], "scale": 2}`},
+		{"add replaces member", `[{"op": "add", "path": "/name", "value": "db"}]`,
+			`{"name": "db", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"]}`},
+		{"add null", `[{"op": "add", "path": "/scale", "value": null}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"], "scale": null}`},
+		{"add array index", `[{"op": "add", "path": "/ports/1", "value": "8080"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "8080", "443"]}`},
+		{"add array end", `[{"op": "add", "path": "/ports/-", "value": "8080"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443", "8080"]}`},
+		{"remove member", `[{"op": "remove", "path": "/name"}]`,
+			`{"labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"]}`},
+		{"remove array index", `[{"op": "remove", "path": "/ports/0"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["443"]}`},
+		{"replace", `[{"op": "replace", "path": "/ports/0", "value": "81"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["81", "443"]}`},
+		{"replace whole document", `[{"op": "replace", "path": "", "value": {"x": 1}}]`,
+			`{"x": 1}`},
+		{"move", `[{"op": "move", "from": "/name", "path": "/labels/name"}]`,
+			`{"labels": {"a/b": "1", "c~d": "2", "name": "web"}, "ports": ["80", "443"]}`},
+		{"copy", `[{"op": "copy", "from": "/ports", "path": "/exposed"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"], "exposed": ["80", "443"]}`},
+		{"test passes", `[{"op": "test", "path": "/ports", "value": ["80", "443"]}]`,
+			doc},
+		{"escaped slash", `[{"op": "replace", "path": "/labels/a~1b", "value": "x"}]`,
+			`{"name": "web", "labels": {"a/b": "x", "c~d": "2"}, "ports": ["80", "443"]}`},
+		{"escaped tilde", `[{"op": "remove", "path": "/labels/c~0d"}]`,
+			`{"name": "web", "labels": {"a/b": "1"}, "ports": ["80", "443"]}`},
+		{"operations in order", `[{"op": "add", "path": "/tmp", "value": {}}, {"op": "add", "path": "/tmp/x", "value": 1}, {"op": "move", "from": "/tmp/x", "path": "/x"}, {"op": "remove", "path": "/tmp"}]`,
+			`{"name": "web", "labels": {"a/b": "1", "c~d": "2"}, "ports": ["80", "443"], "x": 1}`},
+	}
+	for _, test := range tests {
+		original := decodeJSON(t, doc)
+		got, err := ApplyJSONPatch(original, decodePatch(t, test.patch))
+		if err != nil {
+			t.Errorf("%v: failed: %v", test.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("%v: got %v, want %v", test.name, got, test.want)
+		}
+		if !reflect.DeepEqual(original, decodeJSON(t, doc)) {
+			t.Errorf("%v: the input document was changed to %v", test.name, original)
+		}
+	}
+}
+
+func TestApplyJSONPatchErrors(t *testing.T) {
+	doc := `{"name": "web", "ports": ["80", "443"]}`
+	tests := []struct {
+		name  string
+		patch string
+	}{
+		{"unknown op", `[{"op": "merge", "path": "/name", "value": 1}]`},
+		{"missing value", `[{"op": "add", "path": "/name"}]`},
+		{"pointer without slash", `[{"op": "add", "path": "name", "value": 1}]`},
+		{"add to missing parent", `[{"op": "add", "path": "/a/b", "value": 1}]`},
+		{"add past array end", `[{"op": "add", "path": "/ports/3", "value": "1"}]`},
+		{"leading zero index", `[{"op": "add", "path": "/ports/01", "value": "1"}]`},
+		{"negative index", `[{"op": "remove", "path": "/ports/-1"}]`},
+		{"remove missing", `[{"op": "remove", "path": "/missing"}]`},
+		{"remove array end", `[{"op": "remove", "path": "/ports/-"}]`},
+		{"remove whole document", `[{"op": "remove", "path": ""}]`},
+		{"replace missing", `[{"op": "replace", "path": "/missing", "value": 1}]`},
+		{"test fails", `[{"op": "test", "path": "/name", "value": "db"}]`},
+		{"move from missing", `[{"op": "move", "from": "/missing", "path": "/x"}]`},
+		{"move into itself", `[{"op": "move", "from": "/ports", "path": "/ports/0"}]`},
+		{"index into a string", `[{"op": "add", "path": "/name/0", "value": 1}]`},
+		{"later operation fails", `[{"op": "add", "path": "/x", "value": 1}, {"op": "remove", "path": "/y"}]`},
+	}
+	for _, test := range tests {
+		original := decodeJSON(t, doc)
+		if got, err := ApplyJSONPatch(original, decodePatch(t, test.patch)); err == nil {
+			t.Errorf("%v: got %v, want an error", test.name, got)
+		}
+		if !reflect.DeepEqual(original, decodeJSON(t, doc)) {
+			t.Errorf("%v: the input document was changed to %v", test.name, original)
+		}
+	}
+}
+
+func TestParseJSONPointer(t *testing.T) {
+	tests := []struct {
+		pointer string
+		want    []string
+	}{
+		{"", nil},
+		{"/", []string{""}},
+		{"/a/b", []string{"a", "b"}},
+		{"/a~1b/c~0d", []string{"a/b", "c~d"}},
+		//~01 is ~1 escaped, not /
+		{"/~01", []string{"~1"}},
+	}
+	for _, test := range tests {
+		got, err := parseJSONPointer(test.pointer)
+		if err != nil {
+			t.Errorf("parseJSONPointer(%v) failed: %v", test.pointer, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("parseJSONPointer(%v) = %q, want %q", test.pointer, got, test.want)
+		}
+	}
+}
+
+func TestApplyMergePatch(t *testing.T) {
+	tests := []struct {
+		target, patch, want string
+	}{
+		{`{"a": 1, "b": 2}`, `{"a": 3}`, `{"a": 3, "b": 2}`},
+		{`{"a": 1, "b": 2}`, `{"a": null}`, `{"b": 2}`},
+		{`{"a": {"x": 1, "y": 2}}`, `{"a": {"y": null, "z": 3}}`, `{"a": {"x": 1, "z": 3}}`},
+		{`{"a": [1, 2]}`, `{"a": [3]}`, `{"a": [3]}`},
+		{`{"a": 1}`, `["x"]`, `["x"]`},
+		{`"x"`, `{"a": 1}`, `{"a": 1}`},
+	}
+	for _, test := range tests {
+		got, err := ApplyMergePatch(decodeJSON(t, test.target), decodeJSON(t, test.patch))
+		if err != nil {
+			t.Errorf("ApplyMergePatch(%v, %v) failed: %v", test.target, test.patch, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("ApplyMergePatch(%v, %v) = %v, want %v", test.target, test.patch, got, test.want)
+		}
+	}
+}
+
+func TestApplyHeaderOperations(t *testing.T) {
+	headers := map[string][]string{"accept": {"application/json"}, "X-Old": {"1"}}
+	operations := []model.HeaderOperation{
+		{Op: "add", Name: "x-team", Value: "a"},
+		{Op: "add", Name: "X-Team", Value: "b"},
+		{Op: "set", Name: "Accept", Value: "text/plain"},
+		{Op: "remove", Name: "x-old"},
+	}
+	got, err := ApplyHeaderOperations(headers, operations)
+	if err != nil {
+		t.Fatalf("ApplyHeaderOperations failed: %v", err)
+	}
+	want := map[string][]string{"Accept": {"text/plain"}, "X-Team": {"a", "b"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	for _, operation := range []model.HeaderOperation{{Op: "add", Value: "a"}, {Op: "append", Name: "X-A"}} {
+		if _, err := ApplyHeaderOperations(headers, []model.HeaderOperation{operation}); err == nil {
+			t.Errorf("%+v: want an error", operation)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//JSONPath is a parsed JSONPath expression limited to child and wildcard steps, e.g. $.launchConfig.ports[*]
+type JSONPath []jsonPathStep
+
+type jsonPathStep struct {
+	key      string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+//ParseJSONPath parses expressions like $.a.b, $.a[0].b, $['a'].b or $.a[*].b
+func ParseJSONPath(expression string) (JSONPath, error) {
+	if !strings.HasPrefix(expression, "$") {
+		return nil, fmt.Errorf("JSONPath %v must start with $", expression)
+	}
+	var path JSONPath
+	rest := expression[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			name := rest[:end]
+			if name == "" {
+				return nil, fmt.Errorf("JSONPath %v has an empty name", expression)
+			}
+			path = append(path, jsonPathStep{key: name, wildcard: name == "*"})
+			rest = rest[end:]
+		case '[':
+			end := strings.Index(rest, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("JSONPath %v has an unclosed [", expression)
+			}
+			selector := rest[1:end]
+			rest = rest[end+1:]
+			switch {
+			case selector == "*":
+				path = append(path, jsonPathStep{wildcard: true})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				path = append(path, jsonPathStep{key: selector[1 : len(selector)-1]})
+			default:
+				index, err := strconv.Atoi(selector)
+				if err != nil || index < 0 {
+					return nil, fmt.Errorf("JSONPath %v has an invalid index %v", expression, selector)
+				}
+				path = append(path, jsonPathStep{index: index, isIndex: true})
+			}
+		default:
+			return nil, fmt.Errorf("JSONPath %v is invalid at %v", expression, rest)
+		}
+	}
+	return path, nil
+}
+
+//String returns the expression of the path
+func (p JSONPath) String() string {
+	expression := "$"
+	for _, step := range p {
+		switch {
+		case step.wildcard:
+			expression += "[*]"
+		case step.isIndex:
+			expression += "[" + strconv.Itoa(step.index) + "]"
+		default:
+			expression += "['" + step.key + "']"
+		}
+	}
+	return expression
+}
+
+//Select returns a copy of doc holding only the values the path points to, false if there are none.
+//Arrays keep their length with nil in the positions not selected, so selections can be merged.
+func (p JSONPath) Select(doc interface{}) (interface{}, bool) {
+	if len(p) == 0 {
+		return doc, true
+	}
+	step := p[0]
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		if step.isIndex {
+			return nil, false
+		}
+		selected := make(map[string]interface{})
+		for key, child := range value {
+			if !step.wildcard && key != step.key {
+				continue
+			}
+			if childSelected, ok := p[1:].Select(child); ok {
+				selected[key] = childSelected
+			}
+		}
+		return selected, len(selected) > 0
+	case []interface{}:
+		if !step.isIndex && !step.wildcard {
+			return nil, false
+		}
+		selected := make([]interface{}, len(value))
+		found := false
+		for i, child := range value {
+			if !step.wildcard && i != step.index {
+				continue
+			}
+			if childSelected, ok := p[1:].Select(child); ok {
+				selected[i] = childSelected
+				found = true
+			}
+		}
+		return selected, found
+	}
+	return nil, false
+}
+
+//Replace returns a copy of doc where every value the path points to is replaced by replaceFn(value)
+func (p JSONPath) Replace(doc interface{}, replaceFn func(interface{}) interface{}) interface{} {
+	if len(p) == 0 {
+		return replaceFn(doc)
+	}
+	step := p[0]
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		replaced := make(map[string]interface{}, len(value))
+		for key, child := range value {
+			if !step.isIndex && (step.wildcard || key == step.key) {
+				child = p[1:].Replace(child, replaceFn)
+			}
+			replaced[key] = child
+		}
+		return replaced
+	case []interface{}:
+		replaced := make([]interface{}, len(value))
+		for i, child := range value {
+			if step.wildcard || (step.isIndex && i == step.index) {
+				child = p[1:].Replace(child, replaceFn)
+			}
+			replaced[i] = child
+		}
+		return replaced
+	}
+	return doc
+}
+
+//MergeSelections deep merges two results of JSONPath.Select
+func MergeSelections(a interface{}, b interface{}) interface{} {
+	switch aValue := a.(type) {
+	case map[string]interface{}:
+		bValue, ok := b.(map[string]interface{})
+		if !ok {
+			return a
+		}
+		merged := make(map[string]interface{}, len(aValue))
+		for key, child := range aValue {
+			merged[key] = child
+		}
+		for key, child := range bValue {
+			if existing, ok := merged[key]; ok {
+				merged[key] = MergeSelections(existing, child)
+			} else {
+				merged[key] = child
+			}
+		}
+		return merged
+	case []interface{}:
+		bValue, ok := b.([]interface{})
+		if !ok || len(aValue) != len(bValue) {
+			return a
+		}
+		merged := make([]interface{}, len(aValue))
+		for i := range aValue {
+			switch {
+			case aValue[i] == nil:
+				merged[i] = bValue[i]
+			case bValue[i] == nil:
+				merged[i] = aValue[i]
+			default:
+				merged[i] = MergeSelections(aValue[i], bValue[i])
+			}
+		}
+		return merged
+	case nil:
+		return b
+	}
+	return a
+}
@@ -0,0 +1,130 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func decodeJSON(t *testing.T, content string) interface{} {
+	var doc interface{}
+	if err := json.Unmarshal([]byte(content), &doc); err != nil {
+		t.Fatalf("invalid test JSON %v: %v", content, err)
+	}
+	return doc
+}
+
+func TestParseJSONPath(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+		wantErr    bool
+	}{
+		{expression: "$", want: "$"},
+		{expression: "$.a.b", want: "$['a']['b']"},
+		{expression: "$.a[0].b", want: "$['a'][0]['b']"},
+		{expression: "$['a.b'].c", want: "$['a.b']['c']"},
+		{expression: `$["a"]`, want: "$['a']"},
+		{expression: "$.a[*].b", want: "$['a'][*]['b']"},
+		{expression: "$.*", want: "$[*]"},
+		{expression: "a.b", wantErr: true},
+		{expression: "$.a..b", wantErr: true},
+		{expression: "$.a[0", wantErr: true},
+		{expression: "$.a[-1]", wantErr: true},
+		{expression: "$.a[x]", wantErr: true},
+		{expression: "$a", wantErr: true},
+	}
+	for _, test := range tests {
+		path, err := ParseJSONPath(test.expression)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("ParseJSONPath(%v) = %v, want an error", test.expression, path)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseJSONPath(%v) failed: %v", test.expression, err)
+			continue
+		}
+		if path.String() != test.want {
+			t.Errorf("ParseJSONPath(%v) = %v, want %v", test.expression, path, test.want)
+		}
+	}
+}
+
+func TestJSONPathSelect(t *testing.T) {
+	doc := `{"name": "web", "launchConfig": {"imageUuid": "docker:nginx", "ports": ["80:80", "443:443"]}, "secondaryLaunchConfigs": [{"name": "a", "imageUuid": "docker:a"}, {"name": "b"}]}`
+	tests := []struct {
+		expression string
+		want       string
+		found      bool
+	}{
+		{"$.name", `{"name": "web"}`, true},
+		{"$.launchConfig.imageUuid", `{"launchConfig": {"imageUuid": "docker:nginx"}}`, true},
+		{"$.launchConfig.ports[1]", `{"launchConfig": {"ports": [null, "443:443"]}}`, true},
+		{"$.secondaryLaunchConfigs[*].imageUuid", `{"secondaryLaunchConfigs": [{"imageUuid": "docker:a"}, null]}`, true},
+		{"$.missing", `null`, false},
+		{"$.name[0]", `null`, false},
+		{"$.launchConfig.ports.x", `null`, false},
+	}
+	for _, test := range tests {
+		path, err := ParseJSONPath(test.expression)
+		if err != nil {
+			t.Fatalf("ParseJSONPath(%v) failed: %v", test.expression, err)
+		}
+		got, found := path.Select(decodeJSON(t, doc))
+		if found != test.found {
+			t.Errorf("Select(%v) found %v, want %v", test.expression, found, test.found)
+			continue
+		}
+		if found && !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("Select(%v) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+}
+
+func TestJSONPathReplace(t *testing.T) {
+	doc := decodeJSON(t, `{"a": {"password": "x", "user": "u"}, "list": [{"password": "y"}, {"other": 1}]}`)
+	redact := func(interface{}) interface{} { return "*" }
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"$.a.password", `{"a": {"password": "*", "user": "u"}, "list": [{"password": "y"}, {"other": 1}]}`},
+		{"$.list[*].password", `{"a": {"password": "x", "user": "u"}, "list": [{"password": "*"}, {"other": 1}]}`},
+		{"$.list[1]", `{"a": {"password": "x", "user": "u"}, "list": [{"password": "y"}, "*"]}`},
+		{"$.missing", `{"a": {"password": "x", "user": "u"}, "list": [{"password": "y"}, {"other": 1}]}`},
+	}
+	for _, test := range tests {
+		path, err := ParseJSONPath(test.expression)
+		if err != nil {
+			t.Fatalf("ParseJSONPath(%v) failed: %v", test.expression, err)
+		}
+		got := path.Replace(doc, redact)
+		if !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("Replace(%v) = %v, want %v", test.expression, got, test.want)
+		}
+	}
+	//the document itself is never changed
+	if !reflect.DeepEqual(doc, decodeJSON(t, `{"a": {"password": "x", "user": "u"}, "list": [{"password": "y"}, {"other": 1}]}`)) {
+		t.Errorf("Replace changed the document: %v", doc)
+	}
+}
+
+func TestMergeSelections(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{`{"a": 1}`, `{"b": 2}`, `{"a": 1, "b": 2}`},
+		{`{"a": {"x": 1}}`, `{"a": {"y": 2}}`, `{"a": {"x": 1, "y": 2}}`},
+		{`{"l": [1, null]}`, `{"l": [null, 2]}`, `{"l": [1, 2]}`},
+		{`{"l": [{"x": 1}]}`, `{"l": [{"y": 2}]}`, `{"l": [{"x": 1, "y": 2}]}`},
+		{`null`, `{"b": 2}`, `{"b": 2}`},
+	}
+	for _, test := range tests {
+		got := MergeSelections(decodeJSON(t, test.a), decodeJSON(t, test.b))
+		if !reflect.DeepEqual(got, decodeJSON(t, test.want)) {
+			t.Errorf("MergeSelections(%v, %v) = %v, want %v", test.a, test.b, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package util
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+//RedactedValue replaces the values hidden from the logs
+const RedactedValue = "[REDACTED]"
+
+//defaultRedactedHeaders are always hidden from the logs
+var defaultRedactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-API-Auth-Signature"}
+
+var (
+	redactionMu     sync.RWMutex
+	redactedHeaders = headerSet(defaultRedactedHeaders)
+	redactedPaths   []JSONPath
+)
+
+func headerSet(names []string) map[string]bool {
+	set := make(map[string]bool)
+	for _, name := range names {
+		set[strings.ToLower(name)] = true
+	}
+	return set
+}
+
+//SetRedaction sets the header names and the JSONPaths of body fields hidden from the logs, on top of the default headers
+func SetRedaction(headers []string, paths []string) error {
+	var parsed []JSONPath
+	for _, expression := range paths {
+		path, err := ParseJSONPath(expression)
+		if err != nil {
+			return fmt.Errorf("Error parsing redaction path: %v", err)
+		}
+		parsed = append(parsed, path)
+	}
+	redactionMu.Lock()
+	defer redactionMu.Unlock()
+	redactedHeaders = headerSet(append(append([]string{}, defaultRedactedHeaders...), headers...))
+	redactedPaths = parsed
+	return nil
+}
+
+//RedactHeaders returns a copy of headers safe to log
+func RedactHeaders(headers map[string][]string) map[string][]string {
+	redactionMu.RLock()
+	defer redactionMu.RUnlock()
+	redacted := make(map[string][]string, len(headers))
+	for key, value := range headers {
+		if redactedHeaders[strings.ToLower(key)] {
+			value = []string{RedactedValue}
+		}
+		redacted[key] = value
+	}
+	return redacted
+}
+
+//RedactJSON returns a copy of a JSON document safe to log. Fields named like a redacted header are
+//hidden wherever they are, the JSONPaths apply to the document and to its body field, so they match
+//request bodies whether logged alone or inside a filter payload. Content that is not JSON is returned as is.
+func RedactJSON(content []byte) []byte {
+	var doc interface{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		return content
+	}
+	redacted, err := json.Marshal(redactDocument(doc))
+	if err != nil {
+		return content
+	}
+	return redacted
+}
+
+//RedactValue marshals v to JSON safe to log
+func RedactValue(v interface{}) string {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("<%v>", err)
+	}
+	return string(RedactJSON(content))
+}
+
+func redactDocument(doc interface{}) interface{} {
+	redactionMu.RLock()
+	defer redactionMu.RUnlock()
+	doc = redactPaths(doc)
+	if object, ok := doc.(map[string]interface{}); ok {
+		if body, ok := object["body"]; ok {
+			object["body"] = redactPaths(body)
+		}
+	}
+	return redactKeys(doc)
+}
+
+func redactPaths(doc interface{}) interface{} {
+	for _, path := range redactedPaths {
+		doc = path.Replace(doc, func(interface{}) interface{} { return RedactedValue })
+	}
+	return doc
+}
+
+func redactKeys(doc interface{}) interface{} {
+	switch value := doc.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if redactedHeaders[strings.ToLower(key)] {
+				value[key] = RedactedValue
+			} else {
+				value[key] = redactKeys(child)
+			}
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = redactKeys(child)
+		}
+	}
+	return doc
+}
+
+//IsRedactedHeader reports if the values of the header are hidden from the logs
+func IsRedactedHeader(name string) bool {
+	redactionMu.RLock()
+	defer redactionMu.RUnlock()
+	return redactedHeaders[strings.ToLower(name)]
+}
+
+//RedactBody returns a copy of a request body safe to log or record, hidden like RedactJSON plus the values at
+//extraPaths. Invalid paths are skipped, they are rejected when the config is loaded.
+func RedactBody(body map[string]interface{}, extraPaths []string) map[string]interface{} {
+	if body == nil {
+		return nil
+	}
+	doc, err := deepCopy(body)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	for _, expression := range extraPaths {
+		if path, err := ParseJSONPath(expression); err == nil {
+			doc = path.Replace(doc, func(interface{}) interface{} { return RedactedValue })
+		}
+	}
+	redacted, _ := redactDocument(doc).(map[string]interface{})
+	return redacted
+}
+
+//RedactJSONPatch returns a copy of operations safe to log. Each value is placed at its path in an otherwise
+//empty document, so the JSONPaths and field names hide it as they would in the whole body.
+func RedactJSONPatch(operations []model.JSONPatchOperation) []model.JSONPatchOperation {
+	var redacted []model.JSONPatchOperation
+	for _, operation := range operations {
+		if len(operation.Value) > 0 {
+			operation.Value = redactPatchValue(operation)
+		}
+		redacted = append(redacted, operation)
+	}
+	return redacted
+}
+
+func redactPatchValue(operation model.JSONPatchOperation) json.RawMessage {
+	masked := rawJSON(RedactedValue)
+	path, err := parseJSONPointer(operation.Path)
+	if err != nil {
+		return masked
+	}
+	var doc interface{}
+	if err := json.Unmarshal(operation.Value, &doc); err != nil {
+		return masked
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		doc = map[string]interface{}{path[i]: doc}
+	}
+	//a parent of the value was hidden as a whole
+	value, err := pointerGet(redactDocument(doc), path)
+	if err != nil {
+		return masked
+	}
+	return rawJSON(value)
+}
+
+//RedactHeaderOperations returns a copy of operations with the values of redacted headers hidden
+func RedactHeaderOperations(operations []model.HeaderOperation) []model.HeaderOperation {
+	var redacted []model.HeaderOperation
+	for _, operation := range operations {
+		if operation.Value != "" && IsRedactedHeader(operation.Name) {
+			operation.Value = RedactedValue
+		}
+		redacted = append(redacted, operation)
+	}
+	return redacted
+}
+
+//RedactDecisions returns a copy of filter decisions with the changes they list safe to log or record
+func RedactDecisions(decisions []model.FilterDecision) []model.FilterDecision {
+	var redacted []model.FilterDecision
+	for _, decision := range decisions {
+		decision.BodyDiff = RedactJSONPatch(decision.BodyDiff)
+		decision.HeaderDiff = RedactHeaderOperations(decision.HeaderDiff)
+		redacted = append(redacted, decision)
+	}
+	return redacted
+}
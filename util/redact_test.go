@@ -0,0 +1,94 @@
+package util
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+func setTestRedaction(t *testing.T, headers []string, paths []string) {
+	if err := SetRedaction(headers, paths); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRedactJSONPatch(t *testing.T) {
+	setTestRedaction(t, nil, []string{"$.registryCredential.password", "$.secrets[*].value"})
+	defer SetRedaction(nil, nil)
+
+	operations := []model.JSONPatchOperation{
+		{Op: "replace", Path: "/registryCredential/password", Value: json.RawMessage(`"hunter2"`)},
+		{Op: "add", Path: "/registryCredential", Value: json.RawMessage(`{"user":"admin","password":"hunter2"}`)},
+		{Op: "add", Path: "/secrets", Value: json.RawMessage(`[{"name":"db","value":"hunter2"}]`)},
+		{Op: "add", Path: "/headers/Authorization", Value: json.RawMessage(`"Bearer token"`)},
+		{Op: "replace", Path: "/scale", Value: json.RawMessage(`3`)},
+		{Op: "remove", Path: "/registryCredential/password"},
+	}
+	want := []string{
+		`"[REDACTED]"`,
+		`{"password":"[REDACTED]","user":"admin"}`,
+		`[{"name":"db","value":"[REDACTED]"}]`,
+		`"[REDACTED]"`,
+		`3`,
+		``,
+	}
+	redacted := RedactJSONPatch(operations)
+	for i, operation := range redacted {
+		if string(operation.Value) != want[i] || operation.Path != operations[i].Path || operation.Op != operations[i].Op {
+			t.Errorf("operation %v: got %v %v %s, want value %s", i, operation.Op, operation.Path, operation.Value, want[i])
+		}
+	}
+	if string(operations[0].Value) != `"hunter2"` {
+		t.Errorf("the operations given were changed")
+	}
+}
+
+func TestRedactBody(t *testing.T) {
+	setTestRedaction(t, []string{"X-Secret"}, []string{"$.registryCredential.password"})
+	defer SetRedaction(nil, nil)
+
+	body := map[string]interface{}{
+		"name":               "web",
+		"x-secret":           "hidden by name",
+		"registryCredential": map[string]interface{}{"password": "hunter2", "user": "admin"},
+		"launchConfig":       map[string]interface{}{"environment": map[string]interface{}{"DB_PASSWORD": "hunter2"}},
+	}
+	got := RedactBody(body, []string{"$.launchConfig.environment"})
+	want := map[string]interface{}{
+		"name":               "web",
+		"x-secret":           RedactedValue,
+		"registryCredential": map[string]interface{}{"password": RedactedValue, "user": "admin"},
+		"launchConfig":       map[string]interface{}{"environment": RedactedValue},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if body["x-secret"] != "hidden by name" || body["registryCredential"].(map[string]interface{})["password"] != "hunter2" {
+		t.Errorf("the body given was changed: %v", body)
+	}
+	if RedactBody(nil, nil) != nil {
+		t.Errorf("nil body not kept nil")
+	}
+}
+
+func TestRedactDecisions(t *testing.T) {
+	decisions := []model.FilterDecision{{
+		Name:       "http",
+		Decision:   model.DecisionAllow,
+		Shadow:     true,
+		BodyDiff:   []model.JSONPatchOperation{{Op: "add", Path: "/cookie", Value: json.RawMessage(`"session"`)}},
+		HeaderDiff: []model.HeaderOperation{{Op: "set", Name: "Authorization", Value: "Basic abc"}, {Op: "set", Name: "X-Tenant", Value: "a"}},
+	}}
+	redacted := RedactDecisions(decisions)
+	if string(redacted[0].BodyDiff[0].Value) != `"[REDACTED]"` {
+		t.Errorf("got body diff value %s", redacted[0].BodyDiff[0].Value)
+	}
+	if redacted[0].HeaderDiff[0].Value != RedactedValue || redacted[0].HeaderDiff[1].Value != "a" {
+		t.Errorf("got header diff %+v", redacted[0].HeaderDiff)
+	}
+	if decisions[0].HeaderDiff[0].Value != "Basic abc" {
+		t.Errorf("the decisions given were changed")
+	}
+}
@@ -0,0 +1,79 @@
+package util
+
+import (
+	"fmt"
+	"os"
+	"sync"
+)
+
+//RotatingFile is an append-only file renamed to path.1, path.2... once it reaches maxBytes
+type RotatingFile struct {
+	path       string
+	maxBytes   int64
+	maxBackups int
+	mu         sync.Mutex
+	file       *os.File
+	size       int64
+}
+
+//NewRotatingFile opens path for appending
+func NewRotatingFile(path string, maxBytes int64, maxBackups int) (*RotatingFile, error) {
+	rotatingFile := &RotatingFile{path: path, maxBytes: maxBytes, maxBackups: maxBackups}
+	if err := rotatingFile.open(); err != nil {
+		return nil, err
+	}
+	return rotatingFile, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("Error opening %v: %v", f.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("Error reading %v: %v", f.path, err)
+	}
+	f.file = file
+	f.size = info.Size()
+	return nil
+}
+
+//Write appends p, rotating first if p does not fit
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.maxBytes > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxBytes {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	f.file.Close()
+	for i := f.maxBackups; i > 0; i-- {
+		from := f.path
+		if i > 1 {
+			from = fmt.Sprintf("%v.%v", f.path, i-1)
+		}
+		if _, err := os.Stat(from); err == nil {
+			os.Rename(from, fmt.Sprintf("%v.%v", f.path, i))
+		}
+	}
+	if f.maxBackups <= 0 {
+		os.Remove(f.path)
+	}
+	return f.open()
+}
+
+//Close closes the current file
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
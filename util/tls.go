@@ -0,0 +1,205 @@
+package util
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+//reloadCheckInterval is the minimum time between two checks of the files on disk
+const reloadCheckInterval = time.Second
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+//ParseTLSVersion converts a version string like "1.2" to the crypto/tls constant
+func ParseTLSVersion(version string) (uint16, error) {
+	if version == "" {
+		return tls.VersionTLS12, nil
+	}
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, fmt.Errorf("Unsupported TLS version %v", version)
+	}
+	return v, nil
+}
+
+//ParseCipherSuites converts a list of IANA cipher suite names to the crypto/tls constants, the suites crypto/tls
+//lists as insecure are refused
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+	insecure := make(map[string]bool)
+	for _, suite := range tls.InsecureCipherSuites() {
+		insecure[suite.Name] = true
+	}
+
+	var ids []uint16
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if insecure[name] {
+			return nil, fmt.Errorf("TLS cipher suite %v is insecure", name)
+		}
+		id, ok := available[name]
+		if !ok {
+			return nil, fmt.Errorf("Unknown TLS cipher suite %v", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+//LoadCertPool reads a PEM encoded CA bundle into a x509.CertPool
+func LoadCertPool(caFile string) (*x509.CertPool, error) {
+	pemContent, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading CA file %v: %v", caFile, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemContent) {
+		return nil, fmt.Errorf("No PEM certificates found in CA file %v", caFile)
+	}
+	return pool, nil
+}
+
+//fileWatch remembers the modification times of a set of files to tell when they change on disk
+type fileWatch struct {
+	files     []string
+	modTimes  []time.Time
+	lastCheck time.Time
+}
+
+//changed reports if any of the files was modified since the last call, at most once per reloadCheckInterval
+func (w *fileWatch) changed() bool {
+	now := time.Now()
+	if now.Sub(w.lastCheck) < reloadCheckInterval {
+		return false
+	}
+	w.lastCheck = now
+
+	modTimes := make([]time.Time, len(w.files))
+	for i, file := range w.files {
+		info, err := os.Stat(file)
+		if err != nil {
+			//keep serving what we have, the file may be in the middle of a swap
+			return false
+		}
+		modTimes[i] = info.ModTime()
+	}
+	isChanged := w.modTimes == nil
+	for i := range w.modTimes {
+		if !modTimes[i].Equal(w.modTimes[i]) {
+			isChanged = true
+		}
+	}
+	w.modTimes = modTimes
+	return isChanged
+}
+
+//CertReloader serves a certificate/key pair from disk and picks up new files when they are rotated
+type CertReloader struct {
+	certFile string
+	keyFile  string
+	mu       sync.Mutex
+	watch    fileWatch
+	cert     *tls.Certificate
+}
+
+//NewCertReloader loads the key pair once and fails if it is not valid
+func NewCertReloader(certFile string, keyFile string) (*CertReloader, error) {
+	reloader := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		watch:    fileWatch{files: []string{certFile, keyFile}},
+	}
+	reloader.watch.changed()
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error loading key pair %v, %v: %v", certFile, keyFile, err)
+	}
+	reloader.cert = &cert
+	return reloader, nil
+}
+
+func (r *CertReloader) current() *tls.Certificate {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watch.changed() {
+		cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			log.Errorf("Error reloading key pair %v, %v, keeping the previous one: %v", r.certFile, r.keyFile, err)
+		} else {
+			log.Infof("Reloaded key pair %v, %v", r.certFile, r.keyFile)
+			r.cert = &cert
+		}
+	}
+	return r.cert
+}
+
+//GetCertificate can be used as tls.Config.GetCertificate
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+//GetClientCertificate can be used as tls.Config.GetClientCertificate
+func (r *CertReloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.current(), nil
+}
+
+//CertPoolReloader serves a CA bundle from disk and picks up a new file when it is rotated
+type CertPoolReloader struct {
+	caFile string
+	mu     sync.Mutex
+	watch  fileWatch
+	pool   *x509.CertPool
+}
+
+//NewCertPoolReloader loads the CA bundle once and fails if it is not valid
+func NewCertPoolReloader(caFile string) (*CertPoolReloader, error) {
+	reloader := &CertPoolReloader{
+		caFile: caFile,
+		watch:  fileWatch{files: []string{caFile}},
+	}
+	reloader.watch.changed()
+	pool, err := LoadCertPool(caFile)
+	if err != nil {
+		return nil, err
+	}
+	reloader.pool = pool
+	return reloader, nil
+}
+
+//Pool returns the current CA bundle, reloading it first if the file changed
+func (r *CertPoolReloader) Pool() *x509.CertPool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.watch.changed() {
+		pool, err := LoadCertPool(r.caFile)
+		if err != nil {
+			log.Errorf("Error reloading CA file %v, keeping the previous one: %v", r.caFile, err)
+		} else {
+			log.Infof("Reloaded CA file %v", r.caFile)
+			r.pool = pool
+		}
+	}
+	return r.pool
+}
@@ -0,0 +1,134 @@
+package util
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    uint16
+		wantErr bool
+	}{
+		{"", tls.VersionTLS12, false},
+		{"1.0", tls.VersionTLS10, false},
+		{"1.2", tls.VersionTLS12, false},
+		{"TLS1.3", tls.VersionTLS13, false},
+		{"tls1.1", tls.VersionTLS11, false},
+		{"1.4", 0, true},
+		{"ssl3", 0, true},
+	}
+	for _, test := range tests {
+		got, err := ParseTLSVersion(test.version)
+		if got != test.want || (err != nil) != test.wantErr {
+			t.Errorf("ParseTLSVersion(%q) = %v, %v, want %v, error %v", test.version, got, err, test.want, test.wantErr)
+		}
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	got, err := ParseCipherSuites([]string{" TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256", "", "TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256"})
+	if err != nil || len(got) != 2 || got[0] != tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256 || got[1] != tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256 {
+		t.Errorf("got %v, %v", got, err)
+	}
+	if got, err := ParseCipherSuites(nil); got != nil || err != nil {
+		t.Errorf("got %v, %v without suites, want the Go defaults", got, err)
+	}
+	for _, name := range []string{"TLS_RSA_WITH_RC4_128_SHA", "TLS_RSA_WITH_3DES_EDE_CBC_SHA", "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA256", "TLS_UNKNOWN"} {
+		if _, err := ParseCipherSuites([]string{name}); err == nil {
+			t.Errorf("cipher suite %v accepted", name)
+		}
+	}
+}
+
+//writeTestKeyPair writes a self-signed certificate with serial and its key to dir
+func writeTestKeyPair(t *testing.T, dir string, serial int64) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	//modification times far enough apart to be seen as a change whatever the file system precision
+	modTime := time.Now().Add(time.Duration(serial) * time.Minute)
+	os.Chtimes(certFile, modTime, modTime)
+	os.Chtimes(keyFile, modTime, modTime)
+	return certFile, keyFile
+}
+
+func servedSerial(t *testing.T, reloader *CertReloader) int64 {
+	cert, err := reloader.GetCertificate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return parsed.SerialNumber.Int64()
+}
+
+func TestCertReloaderPicksUpRotatedFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "tls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, keyFile := writeTestKeyPair(t, dir, 1)
+	reloader, err := NewCertReloader(certFile, keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if serial := servedSerial(t, reloader); serial != 1 {
+		t.Fatalf("got certificate %v, want 1", serial)
+	}
+
+	writeTestKeyPair(t, dir, 2)
+	//the files are checked at most once per reloadCheckInterval
+	reloader.watch.lastCheck = time.Time{}
+	if serial := servedSerial(t, reloader); serial != 2 {
+		t.Errorf("got certificate %v after the files changed, want 2", serial)
+	}
+
+	//a broken file keeps the previous pair
+	if err := ioutil.WriteFile(keyFile, []byte("not a key"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	modTime := time.Now().Add(time.Hour)
+	os.Chtimes(keyFile, modTime, modTime)
+	reloader.watch.lastCheck = time.Time{}
+	if serial := servedSerial(t, reloader); serial != 2 {
+		t.Errorf("got certificate %v after a broken key was written, want 2", serial)
+	}
+}
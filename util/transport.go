@@ -0,0 +1,69 @@
+package util
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+
+	"github.com/rancher/api-filter-proxy/model"
+)
+
+var (
+	transportsMu sync.Mutex
+	transports   = make(map[model.TLSConfig]*http.Transport)
+)
+
+//NewClientTLSConfig builds the tls.Config used to call a filter endpoint or destination
+func NewClientTLSConfig(config model.TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		ServerName:         config.ServerName,
+		InsecureSkipVerify: config.InsecureSkipVerify,
+	}
+	if config.CAFile != "" {
+		pool, err := LoadCertPool(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.CertFile != "" || config.KeyFile != "" {
+		certReloader, err := NewCertReloader(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.GetClientCertificate = certReloader.GetClientCertificate
+	}
+	return tlsConfig, nil
+}
+
+//GetTransport returns the shared http.RoundTripper for the given TLS settings, nil settings use the default transport
+func GetTransport(config *model.TLSConfig) (http.RoundTripper, error) {
+	if config == nil {
+		return http.DefaultTransport, nil
+	}
+
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	if transport, ok := transports[*config]; ok {
+		return transport, nil
+	}
+
+	tlsConfig, err := NewClientTLSConfig(*config)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	transports[*config] = transport
+	return transport, nil
+}
+
+//ResetTransports drops the cached transports so the CA and certificate files are read again
+func ResetTransports() {
+	transportsMu.Lock()
+	defer transportsMu.Unlock()
+	for _, transport := range transports {
+		transport.CloseIdleConnections()
+	}
+	transports = make(map[model.TLSConfig]*http.Transport)
+}
@@ -15,8 +15,6 @@ func SignString(stringToSign []byte, sharedSecret []byte) string {
 	signature := h.Sum(nil)
 	encodedSignature := base64.URLEncoding.EncodeToString(signature)
 
-	log.Debugf("Signature generated: %v", encodedSignature)
-
 	return encodedSignature
 }
 
@@ -27,3 +25,8 @@ func GenerateUUID() string {
 	log.Debugf("time generated: %v", time)
 	return newUUID.String()
 }
+
+//RequestLogger returns a logger adding the request ID to every line
+func RequestLogger(requestID string) *log.Entry {
+	return log.WithField("requestId", requestID)
+}
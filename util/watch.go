@@ -0,0 +1,61 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//fileState is what a watched file looks like on disk
+type fileState struct {
+	//resolved is the path the symlinks point to, a Kubernetes ConfigMap update swaps them
+	resolved string
+	modTime  time.Time
+	size     int64
+	exists   bool
+}
+
+func statFile(path string) fileState {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return fileState{}
+	}
+	info, err := os.Stat(resolved)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{resolved: resolved, modTime: info.ModTime(), size: info.Size(), exists: true}
+}
+
+//WatchFile polls path every interval and calls onChange once the file changed and then stayed the same
+//for debounce, so a burst of writes triggers one call. onChange is not called while the file is missing.
+//When onChange returns false the change stays pending and onChange is called again on the next poll.
+//Closing the returned channel stops the watch.
+func WatchFile(path string, interval time.Duration, debounce time.Duration, onChange func() bool) chan<- struct{} {
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		last := statFile(path)
+		pending := false
+		var changedAt time.Time
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+			current := statFile(path)
+			if current != last {
+				last = current
+				pending = true
+				changedAt = time.Now()
+				continue
+			}
+			if pending && current.exists && time.Since(changedAt) >= debounce {
+				pending = !onChange()
+			}
+		}
+	}()
+	return stop
+}
@@ -0,0 +1,47 @@
+package util
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWatchFileRetriesUntilHandled(t *testing.T) {
+	dir, err := ioutil.TempDir("", "watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(path, []byte("{}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var calls int32
+	stop := WatchFile(path, 10*time.Millisecond, 20*time.Millisecond, func() bool {
+		//the first two calls find a reload already running
+		return atomic.AddInt32(&calls, 1) > 2
+	})
+	defer close(stop)
+
+	//let the watch record the file as it is before changing it
+	time.Sleep(50 * time.Millisecond)
+	if err := ioutil.WriteFile(path, []byte(`{"prefilters":[]}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for atomic.LoadInt32(&calls) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("onChange called %v times, want 3", atomic.LoadInt32(&calls))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	//handled, nothing more until the next change
+	time.Sleep(100 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != 3 {
+		t.Errorf("onChange called %v times after the change was handled, want 3", got)
+	}
+}